@@ -0,0 +1,96 @@
+// FILE: adapt_test.go
+// This file contains tests for the light-adaptation model in adapt.go
+
+package main
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSigmoid(t *testing.T) {
+	s := sigmoid{Midpoint: -2, Slope: 2, Low: 0.2, High: 0.8}
+	if got := s.at(-2); math.Abs(got-0.5) > 1e-12 {
+		t.Errorf("Expected 0.5 at the midpoint, got %g", got)
+	}
+	if got := s.at(-20); math.Abs(got-0.2) > 1e-9 {
+		t.Errorf("Expected the low position in the dark, got %g", got)
+	}
+	if got := s.at(20); math.Abs(got-0.8) > 1e-9 {
+		t.Errorf("Expected the high position in bright light, got %g", got)
+	}
+
+	parsed, err := parseSigmoid(s.String())
+	if err != nil || parsed != s {
+		t.Errorf("Expected %s to parse back to %+v, got %+v (%v)", s, s, parsed, err)
+	}
+	for _, bad := range []string{"-2,2,0", "-2,x,0,1", "-2,0,0,1", "-2,-1,0,1", "-2,2,-0.1,1", "-2,2,0,1.5"} {
+		if _, err := parseSigmoid(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+// TestInterpolateGrid checks that interpolation reproduces the grid at its points,
+// lies between them elsewhere, and ignores an undefined resolution it does not touch.
+func TestInterpolateGrid(t *testing.T) {
+	grid := make([]blockSummary, pigmentSteps*pigmentSteps)
+	for block := range grid {
+		grid[block] = blockSummary{
+			FWHMDegrees:        float64(block / pigmentSteps),
+			SensitivityPercent: float64(block % pigmentSteps),
+		}
+	}
+	last := float64(pigmentSteps - 1)
+	for _, p := range [][2]int{{0, 0}, {3, 7}, {10, 10}} {
+		fwhm, sen := interpolateGrid(grid, float64(p[0])/last, float64(p[1])/last)
+		if math.Abs(fwhm-float64(p[0])) > 1e-9 || math.Abs(sen-float64(p[1])) > 1e-9 {
+			t.Errorf("At step %v: expected %d and %d, got %g and %g", p, p[0], p[1], fwhm, sen)
+		}
+	}
+	if fwhm, sen := interpolateGrid(grid, 0.25/last, 2.5/last); math.Abs(fwhm-0.25) > 1e-9 || math.Abs(sen-2.5) > 1e-9 {
+		t.Errorf("Expected 0.25 and 2.5 between steps, got %g and %g", fwhm, sen)
+	}
+
+	grid[1].FWHMDegrees = math.NaN()
+	if fwhm, _ := interpolateGrid(grid, 0, 0); math.IsNaN(fwhm) {
+		t.Errorf("Expected a defined resolution on a defined step beside an undefined one")
+	}
+	if fwhm, _ := interpolateGrid(grid, 0, 0.5/last); !math.IsNaN(fwhm) {
+		t.Errorf("Expected an undefined resolution next to an undefined step, got %g", fwhm)
+	}
+}
+
+// TestWriteAdaptation checks that interpolating the simulated grid agrees with
+// simulating the states directly at a grid point, and writes a row per light level.
+func TestWriteAdaptation(t *testing.T) {
+	t.Chdir(t.TempDir())
+	model := mustModel(t, nephropsFlatLateral("test_adapt"))
+	grid := model.simulate(nil)
+	a := lightAdaptation{
+		Shielding: sigmoid{Midpoint: 0, Slope: 1, Low: 0.3, High: 0.3},
+		Tapetal:   sigmoid{Midpoint: 0, Slope: 1, Low: 0.6, High: 0.6},
+	}
+	fwhm, sen := model.pigmentResponse(nil, 0.3, 0.6)
+	want := grid[3*pigmentSteps+6]
+	if math.Abs(sen-want.SensitivityPercent) > 1e-6 ||
+		math.IsNaN(fwhm) != math.IsNaN(want.FWHMDegrees) || math.Abs(fwhm-want.FWHMDegrees) > 1e-6 {
+		t.Errorf("Expected the simulated state to match block 39, got %g and %g, want %g and %g",
+			fwhm, sen, want.FWHMDegrees, want.SensitivityPercent)
+	}
+
+	filename, err := model.writeAdaptation(a, sweepValues(-4, 0, 5), grid)
+	if err != nil {
+		t.Fatalf("writeAdaptation returned an unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 6 || lines[0] != adaptationHeader {
+		t.Fatalf("Expected a header and 5 rows, got %q", lines)
+	}
+}
@@ -0,0 +1,289 @@
+// FILE: animate.go
+// This file contains the animated GIF of the point spread function as the pigments
+// migrate through a path of pigment states.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// pigmentPaths names the common routes through pigment space, as waypoints of
+// shielding and tapetal steps.
+var pigmentPaths = map[string][][2]int{
+	// Both pigments advance together, from dark-adapted to fully light-adapted.
+	"diagonal": {{0, 0}, {pigmentSteps - 1, pigmentSteps - 1}},
+	// One pigment advances while the other stays retracted.
+	"shielding": {{0, 0}, {pigmentSteps - 1, 0}},
+	"tapetal":   {{0, 0}, {0, pigmentSteps - 1}},
+}
+
+// parsePigmentPath turns a path specification into the blocks it visits in order. The
+// specification is either the name of one of pigmentPaths or a comma-separated list
+// of shielding:tapetal step waypoints, such as "0:0,10:0,10:10". Consecutive waypoints
+// are joined by the straightest run of grid cells between them.
+func parsePigmentPath(spec string) ([]int, error) {
+	waypoints, ok := pigmentPaths[strings.ToLower(spec)]
+	if !ok {
+		for _, part := range strings.Split(spec, ",") {
+			s, t, found := strings.Cut(strings.TrimSpace(part), ":")
+			if !found {
+				return nil, fmt.Errorf("waypoint %q is not of the form shielding:tapetal", part)
+			}
+			shielding, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("waypoint %q: %w", part, err)
+			}
+			tapetal, err := strconv.Atoi(t)
+			if err != nil {
+				return nil, fmt.Errorf("waypoint %q: %w", part, err)
+			}
+			if shielding < 0 || shielding >= pigmentSteps || tapetal < 0 || tapetal >= pigmentSteps {
+				return nil, fmt.Errorf("waypoint %q is outside the pigment steps 0-%d", part, pigmentSteps-1)
+			}
+			waypoints = append(waypoints, [2]int{shielding, tapetal})
+		}
+	}
+
+	blocks := []int{waypoints[0][0]*pigmentSteps + waypoints[0][1]}
+	for i := 1; i < len(waypoints); i++ {
+		from, to := waypoints[i-1], waypoints[i]
+		ds, dt := to[0]-from[0], to[1]-from[1]
+		n := max(ds, -ds, dt, -dt)
+		for k := 1; k <= n; k++ {
+			s := from[0] + int(math.Round(float64(ds*k)/float64(n)))
+			t := from[1] + int(math.Round(float64(dt*k)/float64(n)))
+			blocks = append(blocks, s*pigmentSteps+t)
+		}
+	}
+	return blocks, nil
+}
+
+// Animation frame layout, in pixels.
+const (
+	frameWidth  = 640
+	frameHeight = 360
+	framePlotX  = 40
+	framePlotY  = 20
+	framePlotW  = 440
+	framePlotH  = 300
+	frameGridX  = 510
+	frameGridY  = 40
+	frameCell   = 10
+)
+
+// Animation palette indices.
+const (
+	paletteBackground = iota
+	paletteAxis
+	paletteGuide
+	paletteFill
+	paletteCurve
+	paletteHalfMax
+	palettePath
+	paletteCurrent
+	paletteShielding
+	paletteTapetal
+)
+
+var framePalette = color.Palette{
+	color.RGBA{255, 255, 255, 255},
+	color.RGBA{0, 0, 0, 255},
+	color.RGBA{200, 200, 200, 255},
+	color.RGBA{178, 203, 230, 255},
+	color.RGBA{31, 59, 115, 255},
+	color.RGBA{224, 130, 20, 255},
+	color.RGBA{120, 120, 120, 255},
+	color.RGBA{214, 39, 40, 255},
+	color.RGBA{140, 86, 75, 255},
+	color.RGBA{230, 184, 0, 255},
+}
+
+// frame is one image of the animation, with the drawing primitives it needs.
+type frame struct {
+	*image.Paletted
+}
+
+func newFrame() frame {
+	return frame{image.NewPaletted(image.Rect(0, 0, frameWidth, frameHeight), framePalette)}
+}
+
+func (f frame) fill(x0, y0, x1, y1 int, c uint8) {
+	for y := max(y0, 0); y < min(y1, frameHeight); y++ {
+		for x := max(x0, 0); x < min(x1, frameWidth); x++ {
+			f.SetColorIndex(x, y, c)
+		}
+	}
+}
+
+// line draws a straight line with Bresenham's algorithm. Every dash-th run of
+// pixels is left out when dash is positive, for a dashed line.
+func (f frame) line(x0, y0, x1, y1 int, c uint8, dash int) {
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	dx, dy := sx*(x1-x0), -sy*(y1-y0)
+	e := dx + dy
+	for n := 0; ; n++ {
+		if dash <= 0 || (n/dash)%2 == 0 {
+			f.SetColorIndex(x0, y0, c)
+		}
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * e; e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 := 2 * e; e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// renderPSFFrame draws one pigment state's point spread function, mirrored about the
+// optic axis, on a vertical scale shared by every frame so the loss of sensitivity is
+// visible as well as the change of shape. The half maximum of the state's own peak is
+// marked across the width it spans. An inset shows the pigment grid with the path
+// and the current state, and bars beside it the extent of each pigment.
+func renderPSFFrame(s blockSummary, scale, maxAngle, ommatidialAngle float64, path []int, block int) *image.Paletted {
+	f := newFrame()
+	bottom := framePlotY + framePlotH
+	px := func(angle float64) int {
+		return framePlotX + int(math.Round((angle+maxAngle)/(2*maxAngle)*framePlotW))
+	}
+	py := func(v float64) int { return bottom - int(math.Round(v/scale*framePlotH)) }
+
+	// Ticks every degree, with a guide line on the optic axis.
+	for d := 0.0; d <= maxAngle; d++ {
+		for _, x := range []int{px(d), px(-d)} {
+			f.line(x, bottom, x, bottom+4, paletteAxis, 0)
+		}
+	}
+	f.line(px(0), framePlotY, px(0), bottom, paletteGuide, 0)
+
+	// Sample the profile, interpolating between rhabdom offsets, column by column.
+	value := func(angle float64) float64 {
+		pos := math.Abs(angle) / ommatidialAngle
+		j := int(pos)
+		if j >= len(s.PSF)-1 {
+			return 0
+		}
+		frac := pos - float64(j)
+		return s.PSF[j]*(1-frac) + s.PSF[j+1]*frac
+	}
+	prevY := -1
+	for x := framePlotX; x <= framePlotX+framePlotW; x++ {
+		angle := (float64(x-framePlotX)/framePlotW)*2*maxAngle - maxAngle
+		y := py(value(angle))
+		f.line(x, y, x, bottom, paletteFill, 0)
+		if prevY >= 0 {
+			f.line(x-1, prevY, x, y, paletteCurve, 0)
+			f.line(x-1, prevY-1, x, y-1, paletteCurve, 0)
+		}
+		prevY = y
+	}
+
+	if !math.IsNaN(s.FWHMDegrees) && len(s.PSF) > 0 {
+		half := py(slices.Max(s.PSF) / 2)
+		f.line(px(-s.FWHMDegrees/2), half, px(s.FWHMDegrees/2), half, paletteHalfMax, 4)
+		f.line(px(-s.FWHMDegrees/2), half+1, px(s.FWHMDegrees/2), half+1, paletteHalfMax, 4)
+	}
+
+	f.line(framePlotX, bottom, framePlotX+framePlotW, bottom, paletteAxis, 0)
+	f.line(framePlotX, framePlotY, framePlotX, bottom, paletteAxis, 0)
+
+	// Pigment grid inset: shielding steps down, tapetal steps across, as in the
+	// summary matrices.
+	grid := frameCell * pigmentSteps
+	for k := 0; k <= pigmentSteps; k++ {
+		f.line(frameGridX, frameGridY+k*frameCell, frameGridX+grid, frameGridY+k*frameCell, paletteGuide, 0)
+		f.line(frameGridX+k*frameCell, frameGridY, frameGridX+k*frameCell, frameGridY+grid, paletteGuide, 0)
+	}
+	centre := func(b int) (int, int) {
+		return frameGridX + (b%pigmentSteps)*frameCell + frameCell/2, frameGridY + (b/pigmentSteps)*frameCell + frameCell/2
+	}
+	for i := 1; i < len(path); i++ {
+		x0, y0 := centre(path[i-1])
+		x1, y1 := centre(path[i])
+		f.line(x0, y0, x1, y1, palettePath, 0)
+	}
+	x, y := centre(block)
+	f.fill(x-frameCell/2+1, y-frameCell/2+1, x+frameCell/2, y+frameCell/2, paletteCurrent)
+
+	// Pigment extents below the inset, as fractions of the rhabdom.
+	barTop := frameGridY + grid + 30
+	const barH = 150
+	shielding, tapetal := block/pigmentSteps, block%pigmentSteps
+	for i, b := range []struct {
+		step   int
+		colour uint8
+	}{{shielding, paletteShielding}, {tapetal, paletteTapetal}} {
+		x0 := frameGridX + 20 + i*50
+		f.line(x0, barTop, x0, barTop+barH, paletteAxis, 0)
+		f.line(x0+20, barTop, x0+20, barTop+barH, paletteAxis, 0)
+		f.line(x0, barTop+barH, x0+20, barTop+barH, paletteAxis, 0)
+		extent := barH * b.step / (pigmentSteps - 1)
+		f.fill(x0+1, barTop+barH-extent, x0+20, barTop+barH, b.colour)
+	}
+	return f.Paletted
+}
+
+// writePSFAnimation writes {species}_psf.gif, one frame per block along the path, each
+// shown for delay hundredths of a second. It returns the name of the file.
+func (m *Model) writePSFAnimation(summaries []blockSummary, path []int, delay int) (string, error) {
+	if len(summaries) != pigmentSteps*pigmentSteps {
+		return "", fmt.Errorf("expected %d pigment states, got %d", pigmentSteps*pigmentSteps, len(summaries))
+	}
+	if len(path) == 0 {
+		return "", fmt.Errorf("the pigment path visits no blocks")
+	}
+
+	// Every frame shares the axes of the widest and brightest profile on the path.
+	scale, extent := 0.0, 1
+	for _, b := range path {
+		if len(summaries[b].PSF) > 0 {
+			scale = math.Max(scale, slices.Max(summaries[b].PSF))
+		}
+		extent = max(extent, len(summaries[b].PSF))
+	}
+	if scale <= 0 {
+		scale = 1
+	}
+	maxAngle := float64(extent) * m.OmmatidialAngle
+
+	anim := &gif.GIF{}
+	for _, b := range path {
+		anim.Image = append(anim.Image, renderPSFFrame(summaries[b], scale, maxAngle, m.OmmatidialAngle, path, b))
+		anim.Delay = append(anim.Delay, delay)
+	}
+	// Hold the last state before the animation loops.
+	anim.Delay[len(anim.Delay)-1] = delay * 5
+
+	filename := fmt.Sprintf("%s_psf.gif", m.Params.SpeciesName)
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", fmt.Errorf("creating %s: %w", filename, err)
+	}
+	if err := gif.EncodeAll(file, anim); err != nil {
+		file.Close()
+		return "", fmt.Errorf("writing %s: %w", filename, err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("writing %s: %w", filename, err)
+	}
+	return filename, nil
+}
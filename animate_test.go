@@ -0,0 +1,73 @@
+// FILE: animate_test.go
+// This file contains tests for the point spread function animation in animate.go
+
+package main
+
+import (
+	"image/gif"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParsePigmentPath(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []int
+	}{
+		{"diagonal", []int{0, 12, 24, 36, 48, 60, 72, 84, 96, 108, 120}},
+		{"Tapetal", []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{"0:0, 2:0, 2:2", []int{0, 11, 22, 23, 24}},
+		// A route that is not a straight line through the grid still steps one cell at
+		// a time along its longer axis.
+		{"0:0,2:4", []int{0, 12, 13, 25, 26}},
+		{"5:5", []int{60}},
+	}
+	for _, tt := range tests {
+		got, err := parsePigmentPath(tt.spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.spec, tt.want, got)
+		}
+	}
+
+	for _, spec := range []string{"", "sideways", "0:0,11:0", "0:-1", "a:b"} {
+		if _, err := parsePigmentPath(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+// TestWritePSFAnimation checks that the animation has one frame per block on the path
+// and holds the last frame before looping.
+func TestWritePSFAnimation(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_animate"))
+	path, err := parsePigmentPath("diagonal")
+	if err != nil {
+		t.Fatalf("parsePigmentPath returned an unexpected error: %v", err)
+	}
+	filename, err := model.writePSFAnimation(model.simulate(nil), path, 20)
+	if err != nil {
+		t.Fatalf("writePSFAnimation returned an unexpected error: %v", err)
+	}
+	defer os.Remove(filename)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatalf("Failed to open the animation: %v", err)
+	}
+	defer file.Close()
+	anim, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatalf("The animation is not a valid GIF: %v", err)
+	}
+	if len(anim.Image) != len(path) {
+		t.Fatalf("Expected %d frames, got %d", len(path), len(anim.Image))
+	}
+	if anim.Delay[0] != 20 || anim.Delay[len(path)-1] != 100 {
+		t.Errorf("Expected delays of 20 and a held last frame of 100, got %v", anim.Delay)
+	}
+}
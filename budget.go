@@ -0,0 +1,156 @@
+// FILE: budget.go
+// This file contains the energy budget, which accounts for where all the light
+// incident on the eyeshine patch goes in each pigment state.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// budgetTolerance is how far, in percentage points, a budget may stray from 100% or
+// its absorbed light from the sensitivity before the run flags it. Both are sums of
+// the same terms in a different order, so anything beyond rounding is a bug.
+const budgetTolerance = 1e-6
+
+// energyBudget is the fate of the light incident on the eyeshine patch in one pigment
+// state, each as a percentage of the whole. Facets are weighted by their annulus, as
+// for sensitivity.
+type energyBudget struct {
+	// Rejected is the light the facets turn away, the complement of facetTransmission.
+	Rejected float64
+	// Absorbed is the light absorbed in each rhabdom along the rays, first entered
+	// first, however far the blur circle displaced them.
+	Absorbed []float64
+	// Screening, Reflected, Lost and Transmitted are the light left in the rays at the
+	// end of their trace, by traceResult.Fate.
+	Screening   float64
+	Reflected   float64
+	Lost        float64
+	Transmitted float64
+	// ReflectedAt divides Reflected by the rhabdom offset from the optic axis at which
+	// the tapetum returned it, split between the two offsets that bracket the blur
+	// displacement as the absorbed light is.
+	ReflectedAt []float64
+}
+
+// addToBudget adds one facet's traced ray into the budget.
+func (m *Model) addToBudget(b *energyBudget, facetIndex int, trace traceResult) {
+	incident := 100.0 * ringArea(facetIndex) / m.patchArea()
+	transmission := m.facetTransmission(facetIndex)
+	b.Rejected += incident * (1.0 - transmission)
+
+	absorbed, remaining := absorption(trace.Pathlengths)
+	for len(b.Absorbed) < len(absorbed) {
+		b.Absorbed = append(b.Absorbed, 0)
+	}
+	for i, a := range absorbed {
+		b.Absorbed[i] += incident * transmission * a
+	}
+
+	left := incident * transmission * remaining
+	switch trace.Fate {
+	case fateScreening:
+		b.Screening += left
+	case fateReflected:
+		b.Reflected += left
+		if len(absorbed) > 0 {
+			offset := m.blurOffset(facetIndex) + float64(len(absorbed)-1)
+			base := int(math.Floor(offset))
+			frac := offset - float64(base)
+			b.ReflectedAt = deposit(b.ReflectedAt, base, left*(1.0-frac))
+			if frac > 0 {
+				b.ReflectedAt = deposit(b.ReflectedAt, base+1, left*frac)
+			}
+		}
+	case fateLost:
+		b.Lost += left
+	default:
+		b.Transmitted += left
+	}
+}
+
+// absorbedTotal is the light absorbed in all the rhabdoms.
+func (b energyBudget) absorbedTotal() float64 {
+	total := 0.0
+	for _, a := range b.Absorbed {
+		total += a
+	}
+	return total
+}
+
+// total is the sum of every fate, which should be 100%.
+func (b energyBudget) total() float64 {
+	return b.Rejected + b.absorbedTotal() + b.Screening + b.Reflected + b.Lost + b.Transmitted
+}
+
+// balanced reports whether a block's budget sums to 100% and absorbs exactly the
+// light its sensitivity reports.
+func (s blockSummary) balanced() bool {
+	return math.Abs(s.Budget.total()-100.0) <= budgetTolerance &&
+		math.Abs(s.Budget.absorbedTotal()-s.SensitivityPercent) <= budgetTolerance
+}
+
+// writeEnergyBudget writes {species}_budget.csv: for each pigment state, the
+// percentage of the incident light rejected at the cornea, absorbed in total and in
+// each rhabdom along the rays, absorbed by the screening pigment, reflected back out
+// of the eye, lost beyond 90 degrees and transmitted out of the array, with their sum.
+func (m *Model) writeEnergyBudget(summaries []blockSummary) (string, error) {
+	filename := fmt.Sprintf("%s_budget.csv", m.Params.SpeciesName)
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	// Every row has a column for each rhabdom the longest ray entered.
+	rhabdoms := 0
+	for _, s := range summaries {
+		rhabdoms = max(rhabdoms, len(s.Budget.Absorbed))
+	}
+	header := []string{"block", "shielding_step", "tapetal_step", "shielding_um", "tapetal_um",
+		"rejected_pct", "absorbed_pct"}
+	for i := 1; i <= rhabdoms; i++ {
+		header = append(header, fmt.Sprintf("absorbed_rhabdom%d_pct", i))
+	}
+	header = append(header, "screening_pct", "reflected_pct", "lost_pct", "transmitted_pct", "total_pct")
+	fmt.Fprintln(writer, strings.Join(header, ","))
+
+	for block, s := range summaries {
+		b := s.Budget
+		cells := []string{
+			fmt.Sprint(block), fmt.Sprint(block / pigmentSteps), fmt.Sprint(block % pigmentSteps),
+			fmt.Sprintf("%.6f", s.Shielding), fmt.Sprintf("%.6f", s.Tapetal),
+			fmt.Sprintf("%.4f", b.Rejected), fmt.Sprintf("%.4f", b.absorbedTotal()),
+		}
+		for i := 0; i < rhabdoms; i++ {
+			a := 0.0
+			if i < len(b.Absorbed) {
+				a = b.Absorbed[i]
+			}
+			cells = append(cells, fmt.Sprintf("%.4f", a))
+		}
+		cells = append(cells, fmt.Sprintf("%.4f", b.Screening), fmt.Sprintf("%.4f", b.Reflected),
+			fmt.Sprintf("%.4f", b.Lost), fmt.Sprintf("%.4f", b.Transmitted), fmt.Sprintf("%.4f", b.total()))
+		if _, err := fmt.Fprintln(writer, strings.Join(cells, ",")); err != nil {
+			return filename, fmt.Errorf("writing %s: %w", filename, err)
+		}
+	}
+	return filename, writer.Flush()
+}
+
+// printEnergyBudget prints the budget of the dark- and light-adapted states.
+func printEnergyBudget(summaries []blockSummary) {
+	for _, state := range adaptedStates(len(summaries)) {
+		b := summaries[state.Block].Budget
+		fmt.Printf("Energy budget, %s: rejected %.2f%%, absorbed %.2f%%, screening pigment %.2f%%, "+
+			"reflected out %.2f%%, lost %.2f%%, transmitted %.2f%%\n", state.Label, b.Rejected,
+			b.absorbedTotal(), b.Screening, b.Reflected, b.Lost, b.Transmitted)
+	}
+}
@@ -0,0 +1,105 @@
+// FILE: budget_test.go
+// This file contains tests for the energy budget in budget.go
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestEnergyBudgetBalances checks that every pigment state of the reference eye, and
+// of an eye that loses rays, accounts for all the incident light.
+func TestEnergyBudgetBalances(t *testing.T) {
+	// The astacodes example, whose dark-adapted rays turn past 90 degrees.
+	lossy := Parameters{
+		SpeciesName:              "test_budget_lossy",
+		RhabdomLength:            84,
+		RhabdomWidth:             16,
+		EyeDiameter:              890,
+		FacetWidth:               32,
+		ApertureDiameter:         445,
+		CytoplasmRefractiveIndex: 1.34,
+		RhabdomRefractiveIndex:   1.37,
+		BlurCircleExtent:         4,
+	}
+	for _, p := range []Parameters{nephropsFlatLateral("test_budget"), lossy} {
+		model := mustModel(t, p)
+		summaries := model.simulate(nil)
+		if p.SpeciesName == lossy.SpeciesName && summaries[0].Budget.Lost <= 0 {
+			t.Errorf("Expected the lossy eye to lose light, got %+v", summaries[0].Budget)
+		}
+		for block, s := range summaries {
+			if !s.balanced() {
+				t.Errorf("%s block %d: budget totals %f%% and absorbs %f%%, sensitivity %f%%",
+					p.SpeciesName, block, s.Budget.total(), s.Budget.absorbedTotal(), s.SensitivityPercent)
+			}
+		}
+	}
+}
+
+// TestEnergyBudgetFates checks where the unabsorbed light goes at the corners of the
+// pigment grid.
+func TestEnergyBudgetFates(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_budget"))
+	summaries := model.simulate(nil)
+
+	// Dark-adapted, with neither pigment extended, it all leaves through the base.
+	dark := summaries[0].Budget
+	if dark.Screening != 0 || dark.Reflected != 0 || dark.Transmitted <= 0 {
+		t.Errorf("Expected the dark-adapted state to transmit all it does not absorb, got %+v", dark)
+	}
+	// The tapetum alone returns it out of the eye.
+	tapetal := summaries[pigmentSteps-1].Budget
+	if tapetal.Transmitted != 0 || tapetal.Screening != 0 || tapetal.Reflected <= 0 {
+		t.Errorf("Expected the tapetum to reflect all it does not absorb, got %+v", tapetal)
+	}
+	// Once the screening pigment is out, it absorbs what is left.
+	light := summaries[len(summaries)-1].Budget
+	if light.Transmitted != 0 || light.Reflected != 0 || light.Screening <= 0 {
+		t.Errorf("Expected the screening pigment to absorb all the rhabdoms do not, got %+v", light)
+	}
+	// The cornea rejects the same light whatever the pigments do.
+	if math.Abs(dark.Rejected-light.Rejected) > 1e-12 || dark.Rejected <= 0 {
+		t.Errorf("Expected the same light rejected at the cornea, got %f and %f", dark.Rejected, light.Rejected)
+	}
+}
+
+// TestEnergyBudgetGuidedRay checks that a ray guided by total internal reflection runs
+// past the extended screening pigment to the base, where the pigment over the tapetum
+// absorbs what is left of it, and that its light is all accounted for.
+func TestEnergyBudgetGuidedRay(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_budget"))
+	shielding, tapetal := model.pigmentPositions(pigmentSteps * pigmentSteps / 2)
+	if shielding == 0 {
+		t.Fatal("Expected the middle pigment state to extend the screening pigment")
+	}
+
+	found := false
+	for facet := 1; facet < model.NumberOfFacets; facet++ {
+		trace := model.traceRay(facet, shielding, tapetal)
+		last := trace.Segments[len(trace.Segments)-1]
+		if trace.TerminalCase != "C2" || last.Angle >= model.CriticalAngle {
+			continue
+		}
+		found = true
+		if math.Abs(last.EndDepth-model.Params.RhabdomLength) > 1e-9 {
+			t.Errorf("Facet %d: expected the guided ray to reach the base at %f, stopped at %f",
+				facet, model.Params.RhabdomLength, last.EndDepth)
+		}
+		if trace.Fate != fateScreening {
+			t.Errorf("Facet %d: expected the screening pigment over the tapetum to absorb the guided ray, got %s",
+				facet, trace.Fate)
+		}
+
+		var b energyBudget
+		model.addToBudget(&b, facet, trace)
+		incident := 100.0 * ringArea(facet) / model.patchArea()
+		if math.Abs(b.total()-incident) > budgetTolerance || b.Screening <= 0 || b.Reflected != 0 || b.Transmitted != 0 {
+			t.Errorf("Facet %d: expected %f%% of the light, the rest screened, got %+v", facet, incident, b)
+		}
+	}
+	if !found {
+		t.Fatal("Expected some ray to be guided with the screening pigment extended")
+	}
+}
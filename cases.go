@@ -0,0 +1,101 @@
+// FILE: cases.go
+// This file contains the per-block statistics of how the traced rays ended, which show
+// the physical regime behind each cell of the summary matrices.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// caseStatisticsHeader labels the columns of {species}_cases.csv. There is one count
+// column per terminal case, in the order of caseColours.
+const caseStatisticsHeader = "block,shielding_step,tapetal_step,shielding_um,tapetal_um,rays," +
+	"c1,c2,c3,c4,lost,lost_rays,mean_rhabdoms_entered,max_angle_deg,dominant_case"
+
+// dominantCase returns the terminal case that ended the most rays in a block. Ties go
+// to the case listed first in caseColours.
+func dominantCase(s blockSummary) string {
+	best := ""
+	for _, c := range caseColours {
+		if best == "" || s.Cases[c.Case] > s.Cases[best] {
+			best = c.Case
+		}
+	}
+	return best
+}
+
+// writeCaseStatistics writes {species}_cases.csv: for each pigment state, the number
+// of rays ended by each terminal case, the lost rays, the mean number of rhabdoms a
+// ray entered and the largest angle any ray reached to the rhabdom axis.
+func (m *Model) writeCaseStatistics(summaries []blockSummary) (string, error) {
+	filename := fmt.Sprintf("%s_cases.csv", m.Params.SpeciesName)
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, caseStatisticsHeader)
+	for block, s := range summaries {
+		counts := make([]string, len(caseColours))
+		for i, c := range caseColours {
+			counts[i] = fmt.Sprint(s.Cases[c.Case])
+		}
+		if _, err := fmt.Fprintf(writer, "%d,%d,%d,%.6f,%.6f,%d,%s,%d,%.4f,%.4f,%s\n",
+			block, block/pigmentSteps, block%pigmentSteps, s.Shielding, s.Tapetal, m.NumberOfFacets,
+			strings.Join(counts, ","), s.LostRays, s.MeanRhabdoms, s.MaxAngle, dominantCase(s)); err != nil {
+			return filename, fmt.Errorf("writing %s: %w", filename, err)
+		}
+	}
+	return filename, writer.Flush()
+}
+
+// printCaseSummary prints the terminal cases totalled over every pigment state, the
+// range of rhabdoms entered, the largest angle reached, and how many states each case
+// dominates.
+func (m *Model) printCaseSummary(summaries []blockSummary) {
+	totals := make([]string, len(caseColours))
+	for i, c := range caseColours {
+		n := 0
+		for _, s := range summaries {
+			n += s.Cases[c.Case]
+		}
+		totals[i] = fmt.Sprintf("%s %d", c.Case, n)
+	}
+	fmt.Printf("Terminal cases over %d pigment states (%d rays): %s\n",
+		len(summaries), len(summaries)*m.NumberOfFacets, strings.Join(totals, ", "))
+
+	fewest, most, steepest := 0, 0, 0
+	for block, s := range summaries {
+		if s.MeanRhabdoms < summaries[fewest].MeanRhabdoms {
+			fewest = block
+		}
+		if s.MeanRhabdoms > summaries[most].MeanRhabdoms {
+			most = block
+		}
+		if s.MaxAngle > summaries[steepest].MaxAngle {
+			steepest = block
+		}
+	}
+	fmt.Printf("Mean rhabdoms entered per ray %.2f (block %d) to %.2f (block %d); largest angle to the axis %.4f deg (block %d)\n",
+		summaries[fewest].MeanRhabdoms, fewest, summaries[most].MeanRhabdoms, most,
+		summaries[steepest].MaxAngle, steepest)
+
+	dominant := make(map[string]int)
+	for _, s := range summaries {
+		dominant[dominantCase(s)]++
+	}
+	var parts []string
+	for _, c := range caseColours {
+		if n := dominant[c.Case]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s in %d", c.Case, n))
+		}
+	}
+	fmt.Printf("Dominant case by pigment state: %s\n", strings.Join(parts, ", "))
+}
@@ -0,0 +1,74 @@
+// FILE: cases_test.go
+// This file contains tests for the terminal-case statistics in cases.go
+
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"testing"
+)
+
+// TestCaseStatistics checks the statistics of the reference eye against the rays
+// traced afresh, and that every ray is counted under exactly one case.
+func TestCaseStatistics(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_cases"))
+	summaries := model.simulate(nil)
+
+	for block, s := range summaries {
+		total := 0
+		for _, c := range caseColours {
+			total += s.Cases[c.Case]
+		}
+		if total != model.NumberOfFacets {
+			t.Errorf("Block %d: expected %d rays across the cases, got %d", block, model.NumberOfFacets, total)
+		}
+		if s.Cases["lost"] != s.LostRays {
+			t.Errorf("Block %d: %d lost rays, but %d ended as lost", block, s.LostRays, s.Cases["lost"])
+		}
+	}
+
+	shielding, tapetal := model.pigmentPositions(0)
+	entered, maxAngle := 0, 0.0
+	for facet := 0; facet < model.NumberOfFacets; facet++ {
+		trace := model.traceRay(facet, shielding, tapetal)
+		entered += len(trace.Pathlengths)
+		if trace.MaxAngle > maxAngle {
+			maxAngle = trace.MaxAngle
+		}
+	}
+	if want := float64(entered) / float64(model.NumberOfFacets); summaries[0].MeanRhabdoms != want {
+		t.Errorf("Expected %f rhabdoms entered per ray, got %f", want, summaries[0].MeanRhabdoms)
+	}
+	if summaries[0].MaxAngle != maxAngle {
+		t.Errorf("Expected a largest angle of %f, got %f", maxAngle, summaries[0].MaxAngle)
+	}
+	// Dark-adapted, most rays reach the base without meeting the wall.
+	if got := dominantCase(summaries[0]); got != "C3" {
+		t.Errorf("Expected C3 to dominate the dark-adapted state, got %s", got)
+	}
+
+	if _, err := model.writeCaseStatistics(summaries); err != nil {
+		t.Fatalf("writeCaseStatistics returned an unexpected error: %v", err)
+	}
+	defer os.Remove("test_cases_cases.csv")
+	file, err := os.Open("test_cases_cases.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("The case statistics are not a rectangular CSV: %v", err)
+	}
+	if len(records) != 1+pigmentSteps*pigmentSteps {
+		t.Errorf("Expected a header and %d rows, got %d rows", pigmentSteps*pigmentSteps, len(records))
+	}
+}
+
+func TestDominantCaseTies(t *testing.T) {
+	s := blockSummary{Cases: map[string]int{"C2": 3, "C3": 3, "lost": 1}}
+	if got := dominantCase(s); got != "C2" {
+		t.Errorf("Expected a tie to go to the first case listed, got %s", got)
+	}
+}
@@ -0,0 +1,1121 @@
+// FILE: commands.go
+// This file contains the subcommands of the command line interface.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errNoSpecies is returned by commands that work on one parameter set when none is
+// named.
+var errNoSpecies = errors.New("no species supplied; use the -species flag to choose a parameter set")
+
+// errNoParameterFile is returned by commands that need a parameter file when none
+// was supplied.
+var errNoParameterFile = errors.New("no parameter file supplied; use the -f flag to specify a file")
+
+// parameterFileFlags registers the flags shared by every command that reads a
+// parameter file.
+func parameterFileFlags(fs *flag.FlagSet, strictByDefault bool) (paramFile *string, strict *bool) {
+	paramFile = fs.String("f", "", "Path to a parameter file (CSV format). (Required)")
+	strict = fs.Bool("strict", strictByDefault,
+		"Fail if any record is malformed, rather than skipping it with a warning.")
+	return paramFile, strict
+}
+
+// runCommand simulates every parameter set in a file.
+func runCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, false)
+	debugFlag := fs.Bool("d", false, "Generate debug CSV output file.")
+	legacy := fs.Bool("legacy", false, "Also run the pre-0.6 algorithm and write its integer matrices.")
+	compat := fs.Bool("compat", false, "Also write the results in the pre-0.6 layout and units.")
+	depthBin := fs.Float64("depth-bin", defaultDepthBin,
+		"Width, in micrometres, of the bins of the axial absorption profile.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+	if !(*depthBin > 0) {
+		return fmt.Errorf("-depth-bin must be positive, got %g", *depthBin)
+	}
+
+	manifest := newRunManifest(*paramFile, os.Args)
+	fmt.Printf("Parsing input parameters from %s...\n", *paramFile)
+	paramsList, err := parseInputParameters(*paramFile, *strict)
+	if err != nil {
+		return fmt.Errorf("parsing parameter file: %w", err)
+	}
+
+	// --- Loop over each parameter set and run the model ---
+	var results []speciesResult
+	var skipped []string
+	skip := func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		log.Print(msg)
+		skipped = append(skipped, msg)
+	}
+	for _, params := range paramsList {
+		model, err := NewModel(params)
+		if err != nil {
+			skip("Skipping %s: %v", params.SpeciesName, err)
+			continue
+		}
+		model.DebugMode = *debugFlag
+		model.CompatMode = *compat
+		model.DepthBin = *depthBin
+
+		fmt.Printf("--- Running simulation for %s ---\n", model.Params.SpeciesName)
+		fmt.Printf("%d facets across the eyeshine patch, ommatidial angle %.4f deg, critical angle %.4f deg\n",
+			model.NumberOfFacets, model.OmmatidialAngle, model.CriticalAngle)
+
+		// --- Run Simulation & Calculate Results ---
+		fmt.Printf("Calculating pathlengths for %s...\n", model.Params.SpeciesName)
+		// Every file written for the species is recorded in the manifest, by the name
+		// its writer returns.
+		summaries, outputs, err := model.runModel()
+		if err != nil {
+			skip("Simulation for %s failed: %v", model.Params.SpeciesName, err)
+			continue
+		}
+
+		written, err := model.calculateRessens(summaries)
+		if err != nil {
+			skip("Summary for %s failed: %v", model.Params.SpeciesName, err)
+			continue
+		}
+		outputs = append(outputs, written...)
+
+		filename, err := model.writeCaseStatistics(summaries)
+		if err != nil {
+			skip("Writing case statistics for %s failed: %v", model.Params.SpeciesName, err)
+			continue
+		}
+		outputs = append(outputs, filename)
+		model.printCaseSummary(summaries)
+
+		if filename, err = model.writeEnergyBudget(summaries); err != nil {
+			skip("Writing energy budget for %s failed: %v", model.Params.SpeciesName, err)
+			continue
+		}
+		outputs = append(outputs, filename)
+		printEnergyBudget(summaries)
+
+		if written, err = model.writeEyeshine(summaries); err != nil {
+			skip("Writing eyeshine for %s failed: %v", model.Params.SpeciesName, err)
+			continue
+		}
+		outputs = append(outputs, written...)
+		model.printEyeshine(summaries)
+
+		if written, err = model.writeDepthProfile(summaries); err != nil {
+			skip("Writing depth profile for %s failed: %v", model.Params.SpeciesName, err)
+			continue
+		}
+		outputs = append(outputs, written...)
+		model.printPeakDose(summaries)
+
+		if filename, err = model.writeResultsJSON(summaries); err != nil {
+			skip("Writing results for %s failed: %v", model.Params.SpeciesName, err)
+			continue
+		}
+		outputs = append(outputs, filename)
+
+		if written, err = model.writeHeatmaps(summaries); err != nil {
+			skip("Drawing heatmaps for %s failed: %v", model.Params.SpeciesName, err)
+			continue
+		}
+		outputs = append(outputs, written...)
+
+		if *compat {
+			if written, err = model.writeCompatSummaries(summaries); err != nil {
+				skip("Writing compatibility export for %s failed: %v", model.Params.SpeciesName, err)
+				continue
+			}
+			outputs = append(outputs, written...)
+			fmt.Printf("Wrote compatibility export %s_compat_*.csv in the pre-0.6 layout\n", model.Params.SpeciesName)
+		}
+
+		if *legacy {
+			legacySummaries := model.simulateLegacy()
+			if written, err = writeLegacySummaries(model.Params.SpeciesName+"_legacy_summary", legacySummaries); err != nil {
+				skip("Writing legacy results for %s failed: %v", model.Params.SpeciesName, err)
+				continue
+			}
+			outputs = append(outputs, written...)
+			fmt.Printf("Legacy algorithm, dark-adapted: resolution %d centidegrees, sensitivity %d%%\n",
+				legacySummaries[0].Resolution, legacySummaries[0].Sensitivity)
+		}
+
+		results = append(results, speciesResult{Model: model, Summaries: summaries})
+		manifest.addSpecies(model, outputs)
+		fmt.Printf("--- Finished simulation for %s ---\n\n", model.Params.SpeciesName)
+	}
+
+	if len(results) > 0 {
+		if err := writeSummaryLong("summary_long.csv", results); err != nil {
+			return err
+		}
+		if err := writeReport("report.html", *paramFile, results, skipped); err != nil {
+			return err
+		}
+		manifest.addOutputs("summary_long.csv", "report.html")
+	}
+	manifest.Skipped = append(manifest.Skipped, skipped...)
+	if err := manifest.write("manifest.json"); err != nil {
+		return err
+	}
+
+	if len(skipped) > 0 {
+		return fmt.Errorf("%d of %d parameter sets could not be simulated", len(skipped), len(paramsList))
+	}
+	fmt.Println("All simulations complete.")
+	return nil
+}
+
+// validateCommand checks every parameter set in a file and reports all the problems
+// found, without running any simulation.
+func validateCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, true)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+
+	records, recordErrors, err := readParameterFile(*paramFile)
+	if err != nil {
+		return err
+	}
+	checks := checkParameterRecords(records)
+	problems := writeValidationReport(os.Stdout, *paramFile, checks, recordErrors)
+	if !*strict {
+		// Without strict parsing a run skips malformed records rather than failing,
+		// so they are reported but do not make the file invalid.
+		problems -= len(recordErrors)
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problems found in %s", problems, *paramFile)
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("no valid parameter data found in %s", *paramFile)
+	}
+	fmt.Printf("%d parameter sets are valid.\n", len(records))
+	return nil
+}
+
+// sweepCommand reruns the model while stepping one parameter across a range.
+func sweepCommand(fs *flag.FlagSet, args []string) error {
+	names := make([]string, len(parameterFields))
+	for i, f := range parameterFields {
+		names[i] = f.Name
+	}
+	paramFile, strict := parameterFileFlags(fs, false)
+	param := fs.String("param", "", "Parameter to sweep: one of "+strings.Join(names, ", ")+". (Required)")
+	from := fs.Float64("from", 0, "First value of the swept parameter. (Required)")
+	to := fs.Float64("to", 0, "Last value of the swept parameter. (Required)")
+	steps := fs.Int("steps", 11, "Number of evenly spaced values from -from to -to inclusive.")
+	species := fs.String("species", "", "Only sweep the named parameter set.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+	field, ok := lookupParameterField(*param)
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown parameter %q", *param)
+	}
+	if !flagWasSet(fs, "from") || !flagWasSet(fs, "to") {
+		fs.Usage()
+		return errors.New("both -from and -to are required")
+	}
+	if *steps < 1 {
+		return fmt.Errorf("-steps must be at least 1, got %d", *steps)
+	}
+
+	paramsList, err := parseInputParameters(*paramFile, *strict)
+	if err != nil {
+		return fmt.Errorf("parsing parameter file: %w", err)
+	}
+	values := sweepValues(*from, *to, *steps)
+	swept := 0
+	for _, params := range paramsList {
+		if *species != "" && params.SpeciesName != *species {
+			continue
+		}
+		fmt.Printf("Sweeping %s from %g to %g for %s...\n", field.Name, *from, *to, params.SpeciesName)
+		n, err := runSweep(params, field, values)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("no value of %s gave a valid eye for %s", field.Name, params.SpeciesName)
+		}
+		fmt.Printf("Simulated %d of %d values for %s.\n", n, len(values), params.SpeciesName)
+		swept++
+	}
+	if swept == 0 {
+		return fmt.Errorf("no parameter set named %q in %s", *species, *paramFile)
+	}
+	return nil
+}
+
+// raysCommand draws the ray path diagram for one species and pigment block.
+func raysCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, false)
+	species := fs.String("species", "", "Parameter set to draw. (Required)")
+	block := fs.Int("block", 0, fmt.Sprintf("Pigment block to draw, 0-%d: shielding step * %d + tapetal step.",
+		pigmentSteps*pigmentSteps-1, pigmentSteps))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+	if *species == "" {
+		fs.Usage()
+		return errNoSpecies
+	}
+	// Checked before the file is created, so a bad block leaves no empty diagram.
+	if *block < 0 || *block >= pigmentSteps*pigmentSteps {
+		return fmt.Errorf("-block %d is out of range 0-%d", *block, pigmentSteps*pigmentSteps-1)
+	}
+
+	model, err := loadSpecies(*paramFile, *strict, *species)
+	if err != nil {
+		return err
+	}
+	filename, err := model.writeRayDiagram(*block)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", filename)
+	return nil
+}
+
+// animateCommand writes the animated point spread function for one species.
+func animateCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, false)
+	species := fs.String("species", "", "Parameter set to animate. (Required)")
+	pathSpec := fs.String("path", "diagonal",
+		"Pigment states to visit: diagonal, shielding, tapetal, or shielding:tapetal step waypoints such as 0:0,10:0,10:10.")
+	delay := fs.Int("delay", 200, "Time each frame is shown, in milliseconds.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+	if *species == "" {
+		fs.Usage()
+		return errNoSpecies
+	}
+	if *delay < 10 {
+		return fmt.Errorf("frame delay must be at least 10 ms, got %d", *delay)
+	}
+	path, err := parsePigmentPath(*pathSpec)
+	if err != nil {
+		return fmt.Errorf("parsing pigment path: %w", err)
+	}
+
+	model, err := loadSpecies(*paramFile, *strict, *species)
+	if err != nil {
+		return err
+	}
+	filename, err := model.writePSFAnimation(model.simulate(nil), path, *delay/10)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s (%d frames)\n", filename, len(path))
+	return nil
+}
+
+// convertCommand converts a pathlengths file written by an earlier release into the
+// current schema and recomputes its summaries.
+func convertCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, false)
+	species := fs.String("species", "", "Parameter set the file was produced from. (Default: the file name up to _pathlengths)")
+	prefix := fs.String("o", "", "Prefix for the converted files. (Default {species}_converted)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one legacy pathlengths file, got %d", fs.NArg())
+	}
+	legacyFile := fs.Arg(0)
+	if isCompatExport(legacyFile) {
+		return fmt.Errorf("%s is a compatibility export of the current model, traced with its continuous blur "+
+			"offsets; convert only reads pathlengths files written by releases before 0.6", legacyFile)
+	}
+	if *species == "" {
+		base := filepath.Base(legacyFile)
+		name, _, found := strings.Cut(base, "_pathlengths")
+		if !found {
+			fs.Usage()
+			return fmt.Errorf("cannot tell the species from %q; use the -species flag", base)
+		}
+		*species = name
+	}
+
+	model, err := loadSpecies(*paramFile, *strict, *species)
+	if err != nil {
+		return err
+	}
+	if *prefix == "" {
+		*prefix = *species + "_converted"
+	}
+	written, err := model.convertLegacyPathlengths(legacyFile, *prefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range written {
+		fmt.Printf("Wrote %s\n", name)
+	}
+	return nil
+}
+
+// compareCommand compares two result sets, each either simulated from a parameter
+// file or read back from a results file, and fails if they differ by more than the
+// tolerances given.
+func compareCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, false)
+	prefix := fs.String("o", "", "Prefix for the difference files. (Default compare_A_B)")
+	resAbs := fs.Float64("res-abs", 0, "Largest allowed resolution difference, in degrees.")
+	resRel := fs.Float64("res-rel", 0, "Largest allowed resolution difference, as a fraction of A.")
+	senAbs := fs.Float64("sen-abs", 0, "Largest allowed sensitivity difference, in percentage points.")
+	senRel := fs.Float64("sen-rel", 0, "Largest allowed sensitivity difference, as a fraction of A.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("expected two result sets, got %d", fs.NArg())
+	}
+
+	// A tolerance that was not given is not checked.
+	tol := func(name string, v float64) (float64, error) {
+		if !flagWasSet(fs, name) {
+			return -1, nil
+		}
+		if v < 0 || math.IsNaN(v) {
+			return 0, fmt.Errorf("-%s must not be negative, got %g", name, v)
+		}
+		return v, nil
+	}
+	var resTol, senTol tolerance
+	for _, t := range []struct {
+		name string
+		v    float64
+		dst  *float64
+	}{
+		{"res-abs", *resAbs, &resTol.Absolute},
+		{"res-rel", *resRel, &resTol.Relative},
+		{"sen-abs", *senAbs, &senTol.Absolute},
+		{"sen-rel", *senRel, &senTol.Relative},
+	} {
+		v, err := tol(t.name, t.v)
+		if err != nil {
+			return err
+		}
+		*t.dst = v
+	}
+
+	var paramsList []Parameters
+	var sets [2]resultSet
+	for i, arg := range fs.Args() {
+		if strings.HasSuffix(arg, ".json") {
+			set, err := readResultsJSON(arg)
+			if err != nil {
+				return fmt.Errorf("reading results: %w", err)
+			}
+			sets[i] = set
+			continue
+		}
+
+		if *paramFile == "" {
+			fs.Usage()
+			return fmt.Errorf("%q is not a results file, so a parameter file is needed to simulate it: %w",
+				arg, errNoParameterFile)
+		}
+		if paramsList == nil {
+			var err error
+			if paramsList, err = parseInputParameters(*paramFile, *strict); err != nil {
+				return fmt.Errorf("parsing parameter file: %w", err)
+			}
+		}
+		params, ok := findParameters(paramsList, arg)
+		if !ok {
+			return fmt.Errorf("no parameter set named %q in %s", arg, *paramFile)
+		}
+		model, err := NewModel(params)
+		if err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+		sets[i] = resultSet{Name: params.SpeciesName, Summaries: model.simulate(nil)}
+	}
+
+	if *prefix == "" {
+		*prefix = fmt.Sprintf("compare_%s_%s", sets[0].Name, sets[1].Name)
+	}
+	exceeded, err := compareResults(sets[0], sets[1], *prefix, resTol, senTol)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s_res_abs.csv, _res_rel.csv, _res_flips.csv, _sen_abs.csv and _sen_rel.csv\n", *prefix)
+	if exceeded > 0 {
+		return fmt.Errorf("%d differences exceed the tolerances", exceeded)
+	}
+	if resTol.checked() || senTol.checked() {
+		fmt.Println("All differences are within the tolerances.")
+	}
+	return nil
+}
+
+// flagWasSet reports whether the named flag was given on the command line, for
+// required flags whose zero value is also a legitimate setting.
+func flagWasSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// findParameters returns the parameter set with the given species name.
+func findParameters(paramsList []Parameters, name string) (Parameters, bool) {
+	for _, p := range paramsList {
+		if p.SpeciesName == name {
+			return p, true
+		}
+	}
+	return Parameters{}, false
+}
+
+// loadSpecies parses a parameter file and builds the model of the named parameter set.
+func loadSpecies(paramFile string, strict bool, species string) (*Model, error) {
+	paramsList, err := parseInputParameters(paramFile, strict)
+	if err != nil {
+		return nil, fmt.Errorf("parsing parameter file: %w", err)
+	}
+	params, ok := findParameters(paramsList, species)
+	if !ok {
+		return nil, fmt.Errorf("no parameter set named %q in %s", species, paramFile)
+	}
+	model, err := NewModel(params)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", species, err)
+	}
+	return model, nil
+}
+
+// lightEnvironmentFlags registers the flags shared by every command that places the
+// eye in the light at a depth. The function it returns builds the light environment
+// once the flags are parsed, with a name for the water.
+func lightEnvironmentFlags(fs *flag.FlagSet) func() (lightEnvironment, string, error) {
+	water := fs.String("water", "IB", "Jerlov oceanic water type: I, IA, IB, II or III.")
+	attenuationFile := fs.String("attenuation", "", "Attenuation spectrum file ("+attenuationSpectrumColumns+"), instead of -water.")
+	depth := fs.Float64("depth", 0, "Depth, in metres.")
+	surface := fs.Float64("radiance", 0.1, "Downwelling radiance just below the surface, in W/m²/sr/nm, flat across the band.")
+	bandFrom := fs.Float64("band-from", 400, "Shortest wavelength of the light, in nm.")
+	bandTo := fs.Float64("band-to", 700, "Longest wavelength of the light, in nm.")
+	return func() (lightEnvironment, string, error) {
+		switch {
+		case *depth < 0:
+			return lightEnvironment{}, "", fmt.Errorf("-depth must not be negative, got %g", *depth)
+		case *surface < 0:
+			return lightEnvironment{}, "", fmt.Errorf("-radiance must not be negative, got %g", *surface)
+		case !(*bandFrom > 0) || !(*bandTo > *bandFrom):
+			// The radiance is per nanometre, so a band with no width carries no light.
+			return lightEnvironment{}, "", fmt.Errorf("band %g-%g nm is not a range of positive wavelengths", *bandFrom, *bandTo)
+		}
+		env := lightEnvironment{Depth: *depth, Surface: *surface, BandFrom: *bandFrom, BandTo: *bandTo}
+		var err error
+		if *attenuationFile != "" {
+			if env.Water, err = readAttenuationSpectrum(*attenuationFile); err != nil {
+				return lightEnvironment{}, "", fmt.Errorf("reading attenuation spectrum: %w", err)
+			}
+			return env, *attenuationFile, nil
+		}
+		if env.Water, err = jerlovWater(*water); err != nil {
+			return lightEnvironment{}, "", err
+		}
+		return env, "water type " + strings.ToUpper(*water), nil
+	}
+}
+
+// adaptCommand follows the resolution and sensitivity of one species across light
+// levels, with the pigments placed by the light-adaptation sigmoids.
+func adaptCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, false)
+	species := fs.String("species", "", "Parameter set to adapt. (Required)")
+	from := fs.Float64("from", -6, "Lowest light level, as log10 irradiance in W/m².")
+	to := fs.Float64("to", 2, "Highest light level, as log10 irradiance in W/m².")
+	steps := fs.Int("steps", 33, "Number of evenly spaced light levels from -from to -to inclusive.")
+	shieldingSpec := fs.String("shielding", defaultAdaptation.Shielding.String(),
+		"Screening pigment sigmoid: midpoint,slope,low,high, with the midpoint in log10 W/m² and the positions as fractions of the rhabdom length.")
+	tapetalSpec := fs.String("tapetal", defaultAdaptation.Tapetal.String(), "Tapetal pigment sigmoid, as for -shielding.")
+	interpolate := fs.Bool("interpolate", false, "Interpolate the grid of pigment states rather than simulating each light level.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+	if *species == "" {
+		fs.Usage()
+		return errNoSpecies
+	}
+	if *steps < 1 {
+		return fmt.Errorf("-steps must be at least 1, got %d", *steps)
+	}
+	var a lightAdaptation
+	var err error
+	if a.Shielding, err = parseSigmoid(*shieldingSpec); err != nil {
+		return fmt.Errorf("-shielding: %w", err)
+	}
+	if a.Tapetal, err = parseSigmoid(*tapetalSpec); err != nil {
+		return fmt.Errorf("-tapetal: %w", err)
+	}
+
+	model, err := loadSpecies(*paramFile, *strict, *species)
+	if err != nil {
+		return err
+	}
+	var grid []blockSummary
+	if *interpolate {
+		grid = model.simulate(nil)
+	}
+	filename, err := model.writeAdaptation(a, sweepValues(*from, *to, *steps), grid)
+	if err != nil {
+		return err
+	}
+	for _, l := range []float64{*from, *to} {
+		shielding, tapetal := a.positions(l)
+		fwhm, sensitivity := model.pigmentResponse(grid, shielding, tapetal)
+		fmt.Printf("At 10^%g W/m2: shielding %.3f, tapetal %.3f, resolution %.4f deg, sensitivity %.4f%%\n",
+			l, shielding, tapetal, fwhm, sensitivity)
+	}
+	fmt.Printf("Wrote %s\n", filename)
+	return nil
+}
+
+// dielCommand follows one species through a day of light, with the pigments
+// migrating after the positions the light-adaptation sigmoids give.
+func dielCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, false)
+	species := fs.String("species", "", "Parameter set to follow. (Required)")
+	lightFile := fs.String("light", "", "Light curve file ("+lightCurveColumns+"). (Default daylight at -depth)")
+	surface := fs.Float64("surface", 500, "Irradiance at the surface at noon, in W/m².")
+	depth := fs.Float64("depth", 0, "Depth, in metres.")
+	attenuation := fs.Float64("attenuation", 0.1, "Diffuse attenuation coefficient of the water, per metre.")
+	sunrise := fs.Float64("sunrise", 6, "Time of sunrise, in hours from midnight.")
+	sunset := fs.Float64("sunset", 18, "Time of sunset, in hours from midnight.")
+	night := fs.Float64("night", 1e-6, "Irradiance at night, in W/m².")
+	shieldingSpec := fs.String("shielding", defaultAdaptation.Shielding.String(),
+		"Screening pigment sigmoid: midpoint,slope,low,high, as for adapt.")
+	tapetalSpec := fs.String("tapetal", defaultAdaptation.Tapetal.String(), "Tapetal pigment sigmoid, as for adapt.")
+	shieldingTau := fs.String("shielding-tau", defaultShieldingMigration.String(),
+		"Screening pigment time constants, light,dark, in minutes.")
+	tapetalTau := fs.String("tapetal-tau", defaultTapetalMigration.String(), "Tapetal pigment time constants, as for -shielding-tau.")
+	hours := fs.Float64("hours", 24, "Length of the simulation, in hours from midnight.")
+	step := fs.Float64("step", 10, "Time step, in minutes.")
+	bandFrom := fs.Float64("band-from", 400, "Shortest wavelength of the light, in nm.")
+	bandTo := fs.Float64("band-to", 700, "Longest wavelength of the light, in nm.")
+	interpolate := fs.Bool("interpolate", false, "Interpolate the grid of pigment states rather than simulating each step.")
+	output := fs.String("o", "", "Output file. (Default {species}_diel.csv)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+	if *species == "" {
+		fs.Usage()
+		return errNoSpecies
+	}
+	switch {
+	case !(*hours > 0):
+		return fmt.Errorf("-hours must be positive, got %g", *hours)
+	case !(*step > 0):
+		return fmt.Errorf("-step must be positive, got %g", *step)
+	case !(*bandFrom > 0) || *bandTo < *bandFrom:
+		return fmt.Errorf("band %g-%g nm is not a range of positive wavelengths", *bandFrom, *bandTo)
+	}
+	var a lightAdaptation
+	var shieldingRate, tapetalRate migration
+	var err error
+	if a.Shielding, err = parseSigmoid(*shieldingSpec); err != nil {
+		return fmt.Errorf("-shielding: %w", err)
+	}
+	if a.Tapetal, err = parseSigmoid(*tapetalSpec); err != nil {
+		return fmt.Errorf("-tapetal: %w", err)
+	}
+	if shieldingRate, err = parseMigration(*shieldingTau); err != nil {
+		return fmt.Errorf("-shielding-tau: %w", err)
+	}
+	if tapetalRate, err = parseMigration(*tapetalTau); err != nil {
+		return fmt.Errorf("-tapetal-tau: %w", err)
+	}
+
+	var light lightCurve
+	if *lightFile != "" {
+		if light, err = readLightCurve(*lightFile); err != nil {
+			return fmt.Errorf("reading light curve: %w", err)
+		}
+	} else {
+		switch {
+		case *surface < 0:
+			return fmt.Errorf("-surface must not be negative, got %g", *surface)
+		case !(*night > 0):
+			// The pigments are placed by log irradiance, which total darkness does not have.
+			return fmt.Errorf("-night must be positive, got %g", *night)
+		case *depth < 0 || *attenuation < 0:
+			return errors.New("-depth and -attenuation must not be negative")
+		case *sunrise < 0 || *sunset > 24 || *sunset <= *sunrise:
+			return fmt.Errorf("sunrise at %g h and sunset at %g h are not in order within the day", *sunrise, *sunset)
+		}
+		light = daylight{Surface: *surface, Depth: *depth, Attenuation: *attenuation,
+			Sunrise: *sunrise, Sunset: *sunset, Night: *night}.at
+	}
+
+	model, err := loadSpecies(*paramFile, *strict, *species)
+	if err != nil {
+		return err
+	}
+	var grid []blockSummary
+	if *interpolate {
+		grid = model.simulate(nil)
+	}
+	steps := model.dielCycle(a, shieldingRate, tapetalRate, light, *hours, *step, *bandFrom, *bandTo, grid)
+	if *output == "" {
+		*output = *species + "_diel.csv"
+	}
+	if err := writeDiel(*output, steps); err != nil {
+		return err
+	}
+
+	fmt.Printf("Followed %s through %g h in %d steps of %g min\n", *species, *hours, len(steps)-1, *step)
+	for _, s := range steps {
+		if s.Hours == math.Trunc(s.Hours) && int(s.Hours)%6 == 0 {
+			fmt.Printf("%5.1f h: %.3g W/m2, shielding %.3f, tapetal %.3f, resolution %.4f deg, sensitivity %.4f%%, %.4g photons/s\n",
+				s.Hours, s.Irradiance, s.Shielding, s.Tapetal, s.FWHMDegrees, s.SensitivityPercent, s.AbsorbedPhotons)
+		}
+	}
+	fmt.Printf("Wrote %s\n", *output)
+	return nil
+}
+
+// catchCommand works out the photons each pigment state of one species absorbs
+// from the downwelling light at a depth.
+func catchCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, false)
+	species := fs.String("species", "", "Parameter set to place in the water. (Required)")
+	environment := lightEnvironmentFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+	if *species == "" {
+		fs.Usage()
+		return errNoSpecies
+	}
+	env, waterName, err := environment()
+	if err != nil {
+		return err
+	}
+
+	model, err := loadSpecies(*paramFile, *strict, *species)
+	if err != nil {
+		return err
+	}
+	radianceFile := *species + "_radiance.csv"
+	if err := env.writeRadiance(radianceFile); err != nil {
+		return err
+	}
+	radiance := env.photonRadiance()
+	summaries := model.simulate(nil)
+	catchFile := *species + "_catch.csv"
+	if err := writeFormattedMatrix(catchFile, catchMatrix(model, summaries, radiance), func(v float64) string {
+		return strconv.FormatFloat(v, 'g', 6, 64)
+	}); err != nil {
+		return err
+	}
+
+	fmt.Printf("Downwelling radiance at %g m in %s: %.4g photons/m2/sr/s from %g to %g nm\n",
+		env.Depth, waterName, radiance, env.BandFrom, env.BandTo)
+	for _, state := range adaptedStates(len(summaries)) {
+		fmt.Printf("Photon catch, %s: %.4g photons/s per rhabdom\n", state.Label,
+			model.extendedCatch(summaries[state.Block].SensitivityPercent, radiance))
+	}
+	fmt.Printf("Wrote %s\nWrote %s\n", radianceFile, catchFile)
+	return nil
+}
+
+// detectCommand works out how far away each pigment state of one species can see a
+// bioluminescent flash.
+func detectCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, false)
+	species := fs.String("species", "", "Parameter set to look with. (Required)")
+	photons := fs.Float64("source", 1e10, "Photons the flash emits per second, evenly in every direction.")
+	attenuation := fs.Float64("attenuation", 0.05, "Beam attenuation coefficient of the water at the flash's wavelength, per metre.")
+	threshold := fs.Float64("threshold", 5, "Photons one rhabdom must absorb within the integration time to see the flash.")
+	integration := fs.Float64("integration", 0.1, "Integration time of the photoreceptors, in seconds.")
+	output := fs.String("o", "", "Output file. (Default {species}_range.csv)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+	if *species == "" {
+		fs.Usage()
+		return errNoSpecies
+	}
+	switch {
+	case !(*photons > 0):
+		return fmt.Errorf("-source must be positive, got %g", *photons)
+	case *attenuation < 0:
+		return fmt.Errorf("-attenuation must not be negative, got %g", *attenuation)
+	case !(*threshold > 0):
+		return fmt.Errorf("-threshold must be positive, got %g", *threshold)
+	case !(*integration > 0):
+		return fmt.Errorf("-integration must be positive, got %g", *integration)
+	}
+	f := flash{Photons: *photons, Attenuation: *attenuation, Threshold: *threshold, Integration: *integration}
+
+	model, err := loadSpecies(*paramFile, *strict, *species)
+	if err != nil {
+		return err
+	}
+	summaries := model.simulate(nil)
+	ranges := make([]float64, len(summaries))
+	for i, s := range summaries {
+		ranges[i] = model.detectionRange(s, f)
+	}
+	if *output == "" {
+		*output = *species + "_range.csv"
+	}
+	if err := writeMatrix(*output, ranges); err != nil {
+		return err
+	}
+	printDetectionRange(ranges)
+	fmt.Printf("Wrote %s\n", *output)
+	return nil
+}
+
+// contrastCommand works out the photon noise and contrast sensitivity of each pigment
+// state of one species in the light at a depth.
+func contrastCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, false)
+	species := fs.String("species", "", "Parameter set to place in the water. (Required)")
+	environment := lightEnvironmentFlags(fs)
+	integration := fs.Float64("integration", 0.1, "Integration time of the photoreceptors, in seconds.")
+	dark := fs.Float64("dark", 0, "Dark events per rhabdom per second.")
+	reliability := fs.Float64("reliability", 1, "Standard deviations apart two signals must be to be told apart.")
+	maxFrequency := fs.Float64("max-frequency", 0, "Highest spatial frequency, in cycles per degree. (Default the sampling limit of the rhabdom array)")
+	frequencies := fs.Int("frequencies", 21, "Number of evenly spaced spatial frequencies from 0 to -max-frequency inclusive.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+	if *species == "" {
+		fs.Usage()
+		return errNoSpecies
+	}
+	switch {
+	case !(*integration > 0):
+		return fmt.Errorf("-integration must be positive, got %g", *integration)
+	case *dark < 0:
+		return fmt.Errorf("-dark must not be negative, got %g", *dark)
+	case !(*reliability > 0):
+		return fmt.Errorf("-reliability must be positive, got %g", *reliability)
+	case *maxFrequency < 0:
+		return fmt.Errorf("-max-frequency must not be negative, got %g", *maxFrequency)
+	case *frequencies < 1:
+		return fmt.Errorf("-frequencies must be at least 1, got %d", *frequencies)
+	}
+	env, waterName, err := environment()
+	if err != nil {
+		return err
+	}
+
+	model, err := loadSpecies(*paramFile, *strict, *species)
+	if err != nil {
+		return err
+	}
+	if *maxFrequency == 0 {
+		*maxFrequency = model.nyquistFrequency()
+	}
+	radiance := env.photonRadiance()
+	noise := photonNoise{Integration: *integration, DarkRate: *dark, Reliability: *reliability}
+	signals, err := model.writeContrast(model.simulate(nil), radiance, noise, sweepValues(0, *maxFrequency, *frequencies))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Downwelling radiance at %g m in %s: %.4g photons/m2/sr/s from %g to %g nm\n",
+		env.Depth, waterName, radiance, env.BandFrom, env.BandTo)
+	printContrast(signals)
+	fmt.Printf("Wrote %s_snr.csv\nWrote %s_csf.csv\n", *species, *species)
+	return nil
+}
+
+// optimalCommand finds the pigment state of one species that carries the most
+// information at each light level, and the Pareto front of resolution against
+// sensitivity.
+func optimalCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, false)
+	species := fs.String("species", "", "Parameter set to optimise. (Required)")
+	from := fs.Float64("from", -6, "Lowest light level, as log10 irradiance in W/m².")
+	to := fs.Float64("to", 2, "Highest light level, as log10 irradiance in W/m².")
+	steps := fs.Int("steps", 33, "Number of evenly spaced light levels from -from to -to inclusive.")
+	bandFrom := fs.Float64("band-from", 400, "Shortest wavelength of the light, in nm.")
+	bandTo := fs.Float64("band-to", 700, "Longest wavelength of the light, in nm.")
+	integration := fs.Float64("integration", 0.1, "Integration time of the photoreceptors, in seconds.")
+	dark := fs.Float64("dark", 0, "Dark events per rhabdom per second.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+	if *species == "" {
+		fs.Usage()
+		return errNoSpecies
+	}
+	switch {
+	case *steps < 1:
+		return fmt.Errorf("-steps must be at least 1, got %d", *steps)
+	case !(*bandFrom > 0) || *bandTo < *bandFrom:
+		return fmt.Errorf("band %g-%g nm is not a range of positive wavelengths", *bandFrom, *bandTo)
+	case !(*integration > 0):
+		return fmt.Errorf("-integration must be positive, got %g", *integration)
+	case *dark < 0:
+		return fmt.Errorf("-dark must not be negative, got %g", *dark)
+	}
+
+	model, err := loadSpecies(*paramFile, *strict, *species)
+	if err != nil {
+		return err
+	}
+	summaries := model.simulate(nil)
+	noise := photonNoise{Integration: *integration, DarkRate: *dark, Reliability: 1}
+	optima, err := model.optimalStates(summaries, sweepValues(*from, *to, *steps), *bandFrom, *bandTo, noise)
+	if err != nil {
+		return err
+	}
+	if err := model.writeOptimalStates(summaries, optima); err != nil {
+		return err
+	}
+	front := paretoFront(summaries)
+	if err := model.writeParetoFront(summaries, front); err != nil {
+		return err
+	}
+
+	for _, o := range []optimum{optima[0], optima[len(optima)-1]} {
+		fmt.Printf("At 10^%g W/m2: best block %d (shielding step %d, tapetal step %d), %.4g bits/deg2/s\n",
+			o.LogIrradiance, o.Block, o.Block/pigmentSteps, o.Block%pigmentSteps, o.Information)
+	}
+	changes := 0
+	for i := 1; i < len(optima); i++ {
+		if optima[i].Block != optima[i-1].Block {
+			changes++
+		}
+	}
+	fmt.Printf("The best state changes %d times across %d light levels\n", changes, len(optima))
+	fmt.Printf("Pareto front of resolution against sensitivity: %d of %d pigment states\n", len(front), len(summaries))
+	for _, name := range []string{"information", "optimal", "pareto"} {
+		fmt.Printf("Wrote %s_%s.csv\n", *species, name)
+	}
+	return nil
+}
+
+// damageCommand accumulates the photons one species absorbs over a light exposure
+// regime and fails if the dose anywhere along the rhabdom reaches a damage threshold.
+func damageCommand(fs *flag.FlagSet, args []string) error {
+	paramFile, strict := parameterFileFlags(fs, false)
+	species := fs.String("species", "", "Parameter set to expose. (Required)")
+	regimeFile := fs.String("regime", "", "Exposure regime file ("+exposureRegimeColumns+"). (Required)")
+	thresholdSpec := fs.String("thresholds", "", "Comma-separated damage thresholds, in photons absorbed per cubic micrometre.")
+	depthBin := fs.Float64("depth-bin", defaultDepthBin, "Width, in micrometres, of the rhabdom regions the dose is reported for.")
+	output := fs.String("o", "", "Output file. (Default {species}_damage.csv)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *paramFile == "" {
+		fs.Usage()
+		return errNoParameterFile
+	}
+	if *species == "" {
+		fs.Usage()
+		return errNoSpecies
+	}
+	if *regimeFile == "" {
+		fs.Usage()
+		return errors.New("no exposure regime supplied; use the -regime flag to specify a file")
+	}
+	if !(*depthBin > 0) {
+		return fmt.Errorf("-depth-bin must be positive, got %g", *depthBin)
+	}
+	thresholds, err := parseThresholds(*thresholdSpec)
+	if err != nil {
+		return err
+	}
+	regime, err := readExposureRegime(*regimeFile)
+	if err != nil {
+		return fmt.Errorf("reading exposure regime: %w", err)
+	}
+
+	model, err := loadSpecies(*paramFile, *strict, *species)
+	if err != nil {
+		return err
+	}
+	model.DepthBin = *depthBin
+	if *output == "" {
+		*output = *species + "_damage.csv"
+	}
+	crossings, dose, err := model.exposureDose(regime, thresholds, *output)
+	if err != nil {
+		return err
+	}
+
+	total := 0.0
+	for _, in := range regime {
+		total += in.Duration
+	}
+	fmt.Printf("Exposed %s to %d intervals over %g s\n", *species, len(regime), total)
+	peak := 0
+	for b, d := range dose {
+		if d > dose[peak] {
+			peak = b
+		}
+	}
+	from, to := model.depthBinEdges(peak)
+	fmt.Printf("Largest dose %.4g photons/um^3, %g-%g um from the distal tip\n", dose[peak], from, to)
+	exceeded := 0
+	for _, c := range crossings {
+		if math.IsNaN(c.Time) {
+			fmt.Printf("Threshold %g photons/um^3: not reached\n", c.Threshold)
+			continue
+		}
+		exceeded++
+		from, to := model.depthBinEdges(c.Bin)
+		in := regime[c.Interval]
+		fmt.Printf("Threshold %g photons/um^3: EXCEEDED after %.1f s, %g-%g um from the distal tip, "+
+			"in the interval on line %d (%g W/m2, shielding %g, tapetal %g)\n",
+			c.Threshold, c.Time, from, to, in.Line, in.Irradiance, in.Shielding, in.Tapetal)
+	}
+	fmt.Printf("Wrote %s\n", *output)
+	if exceeded > 0 {
+		return fmt.Errorf("%d of %d damage thresholds exceeded", exceeded, len(thresholds))
+	}
+	return nil
+}
+
+// verifyCommand checks the files recorded in a run manifest against their checksums.
+func verifyCommand(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	filename := "manifest.json"
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		filename = fs.Arg(0)
+	default:
+		fs.Usage()
+		return fmt.Errorf("expected at most one manifest, got %d", fs.NArg())
+	}
+
+	manifest, problems, err := verifyManifest(filename)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: run of %s by pathlength %s (%s), finished %s\n", filename, manifest.ParameterFile.Path,
+		manifest.ProgramVersion, manifest.GoVersion, manifest.FinishedAt.Format(time.RFC3339))
+	for _, p := range problems {
+		fmt.Printf("    %s: %v\n", p.Path, p.Err)
+	}
+	checked := 1 + len(manifest.Outputs)
+	if len(problems) > 0 {
+		return fmt.Errorf("%d of %d files do not match %s", len(problems), checked, filename)
+	}
+	fmt.Printf("All %d files match.\n", checked)
+	return nil
+}
+
+// infoCommand prints the citation, license and the constants built into the model.
+func infoCommand(fs *flag.FlagSet, args []string) error {
+	showCitation := fs.Bool("citation", false, "Show the program citation.")
+	showLicense := fs.Bool("license", false, "Show the program license.")
+	showConstants := fs.Bool("constants", false, "Show the constants built into the model.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	all := !*showCitation && !*showLicense && !*showConstants
+
+	if all {
+		fmt.Printf("%s version %s\n\n", programName(), version)
+	}
+	if all || *showCitation {
+		fmt.Println(citationText)
+	}
+	if all || *showConstants {
+		if all {
+			fmt.Println()
+		}
+		fmt.Printf("Absorption coefficient:   %g um^-1\n", absorptionCoefficient)
+		fmt.Printf("Pigment steps:            %d per pigment (%d pigment states)\n",
+			pigmentSteps, pigmentSteps*pigmentSteps)
+		fmt.Printf("Max propagation angle:    %g deg\n", maxPropagationAngle)
+	}
+	if *showLicense {
+		fmt.Println(licenseText)
+	}
+	return nil
+}
+
+// versionCommand prints the program version.
+func versionCommand(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	fmt.Printf("%s version %s\n", programName(), version)
+	return nil
+}
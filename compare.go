@@ -0,0 +1,245 @@
+// FILE: compare.go
+// This file contains the comparison of two result sets, used to check a change to the
+// parameters or the model for regressions.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// resultSet is the summary of every pigment state of one species, either simulated
+// or read back from a results file.
+type resultSet struct {
+	Name      string
+	Summaries []blockSummary
+}
+
+// readResultsJSON reads the block summaries back from a {species}_results.json file.
+// Files written with a different schema are refused rather than misread.
+func readResultsJSON(filename string) (resultSet, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return resultSet{}, err
+	}
+	var in resultsFile
+	if err := json.Unmarshal(data, &in); err != nil {
+		return resultSet{}, fmt.Errorf("decoding %s: %w", filename, err)
+	}
+	if in.SchemaVersion != resultsSchemaVersion {
+		return resultSet{}, fmt.Errorf("%s has schema version %d, but this release reads version %d",
+			filename, in.SchemaVersion, resultsSchemaVersion)
+	}
+	if len(in.Blocks) != pigmentSteps*pigmentSteps {
+		return resultSet{}, fmt.Errorf("%s has %d pigment states, expected %d",
+			filename, len(in.Blocks), pigmentSteps*pigmentSteps)
+	}
+
+	out := resultSet{Name: in.Parameters.SpeciesName, Summaries: make([]blockSummary, len(in.Blocks))}
+	for i, b := range in.Blocks {
+		if b.Block != i {
+			return resultSet{}, fmt.Errorf("%s lists block %d in position %d", filename, b.Block, i)
+		}
+		s := blockSummary{
+			Shielding:          b.Shielding,
+			Tapetal:            b.Tapetal,
+			LostRays:           b.LostRays,
+			FWHMDegrees:        math.NaN(),
+			SensitivityPercent: b.SensitivityPercent,
+			PeakOffset:         b.PeakOffset,
+			Annular:            b.Annular,
+		}
+		if b.FWHMDegrees != nil {
+			s.FWHMDegrees = *b.FWHMDegrees
+		}
+		out.Summaries[i] = s
+	}
+	return out, nil
+}
+
+// tolerance bounds the difference allowed between two result sets. A negative bound
+// is not checked.
+type tolerance struct {
+	Absolute float64
+	// Relative is a fraction of the first set's value, so 0.01 allows 1%.
+	Relative float64
+}
+
+func (t tolerance) checked() bool {
+	return t.Absolute >= 0 || t.Relative >= 0
+}
+
+// matrixComparison is the cell-by-cell difference of one summary matrix between two
+// result sets, B minus A.
+type matrixComparison struct {
+	Absolute []float64
+	// Relative is the absolute difference as a fraction of A's value. It is zero where
+	// both are zero and infinite where only A is.
+	Relative []float64
+	// Flips lists the blocks defined in one set and NaN in the other. Their
+	// differences are NaN, so they are counted separately.
+	Flips []int
+	// Exceeds marks the blocks outside the tolerance. A flip always exceeds a checked
+	// tolerance, since no difference can be small enough to excuse it.
+	Exceeds []bool
+}
+
+// compareMatrix takes the difference of one summary matrix between two result sets.
+func compareMatrix(a, b []blockSummary, value func(blockSummary) float64, tol tolerance) matrixComparison {
+	out := matrixComparison{
+		Absolute: make([]float64, len(a)),
+		Relative: make([]float64, len(a)),
+		Exceeds:  make([]bool, len(a)),
+	}
+	for i := range a {
+		va, vb := value(a[i]), value(b[i])
+		diff := vb - va
+		rel := diff / math.Abs(va)
+		if diff == 0 {
+			rel = 0
+		}
+		out.Absolute[i], out.Relative[i] = diff, rel
+
+		if math.IsNaN(va) != math.IsNaN(vb) {
+			out.Flips = append(out.Flips, i)
+			out.Exceeds[i] = tol.checked()
+			continue
+		}
+		if math.IsNaN(diff) {
+			continue
+		}
+		out.Exceeds[i] = (tol.Absolute >= 0 && math.Abs(diff) > tol.Absolute) ||
+			(tol.Relative >= 0 && math.Abs(rel) > tol.Relative)
+	}
+	return out
+}
+
+// largest returns the block with the largest magnitude of a difference, ignoring NaN,
+// or -1 if every difference is NaN.
+func largest(values []float64) int {
+	best := -1
+	for i, v := range values {
+		if !math.IsNaN(v) && (best < 0 || math.Abs(v) > math.Abs(values[best])) {
+			best = i
+		}
+	}
+	return best
+}
+
+// exceeded counts the blocks outside the tolerance.
+func (c matrixComparison) exceeded() int {
+	n := 0
+	for _, e := range c.Exceeds {
+		if e {
+			n++
+		}
+	}
+	return n
+}
+
+// printComparisonMap draws the pigment grid as characters, with the shielding steps
+// down and tapetal steps across as in the matrices: "x" for a block outside the
+// tolerance, "!" for a flip between defined and NaN, and "." otherwise.
+func printComparisonMap(c matrixComparison) {
+	flipped := make(map[int]bool, len(c.Flips))
+	for _, b := range c.Flips {
+		flipped[b] = true
+	}
+	for row := 0; row < pigmentSteps; row++ {
+		cells := make([]string, pigmentSteps)
+		for col := range cells {
+			b := row*pigmentSteps + col
+			switch {
+			case flipped[b]:
+				cells[col] = "!"
+			case c.Exceeds[b]:
+				cells[col] = "x"
+			default:
+				cells[col] = "."
+			}
+		}
+		fmt.Printf("    %s\n", strings.Join(cells, " "))
+	}
+}
+
+// writeFlips lists the blocks whose resolution is defined in one set and NaN in the
+// other, with the value from each.
+func writeFlips(filename string, a, b resultSet, flips []int) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, "block,shielding_step,tapetal_step,fwhm_deg_a,fwhm_deg_b")
+	for _, block := range flips {
+		if _, err := fmt.Fprintf(writer, "%d,%d,%d,%s,%s\n", block, block/pigmentSteps, block%pigmentSteps,
+			formatCell("%.4f", a.Summaries[block].FWHMDegrees),
+			formatCell("%.4f", b.Summaries[block].FWHMDegrees)); err != nil {
+			return fmt.Errorf("writing %s: %w", filename, err)
+		}
+	}
+	return writer.Flush()
+}
+
+// compareResults writes the absolute and relative difference matrices of resolution
+// and sensitivity between two result sets, and the resolution flips, to files named
+// from prefix. It prints a summary, and returns the number of blocks outside the
+// tolerances.
+func compareResults(a, b resultSet, prefix string, resTol, senTol tolerance) (int, error) {
+	last := len(a.Summaries) - 1
+	fmt.Printf("%-16s %14s %14s\n", "", a.Name, b.Name)
+	fmt.Printf("%-16s %14.4f %14.4f\n", "dark res (deg)", a.Summaries[0].FWHMDegrees, b.Summaries[0].FWHMDegrees)
+	fmt.Printf("%-16s %14.4f %14.4f\n", "dark sen (%)", a.Summaries[0].SensitivityPercent, b.Summaries[0].SensitivityPercent)
+	fmt.Printf("%-16s %14.4f %14.4f\n", "light res (deg)", a.Summaries[last].FWHMDegrees, b.Summaries[last].FWHMDegrees)
+	fmt.Printf("%-16s %14.4f %14.4f\n", "light sen (%)", a.Summaries[last].SensitivityPercent, b.Summaries[last].SensitivityPercent)
+
+	exceeded := 0
+	for _, q := range []struct {
+		suffix, label, unit string
+		spec                heatmapSpec
+		tol                 tolerance
+	}{
+		{"res", "Resolution", "deg", resolutionHeatmap, resTol},
+		{"sen", "Sensitivity", "percentage points", sensitivityHeatmap, senTol},
+	} {
+		c := compareMatrix(a.Summaries, b.Summaries, q.spec.Value, q.tol)
+		for _, m := range []struct {
+			kind   string
+			values []float64
+		}{{"abs", c.Absolute}, {"rel", c.Relative}} {
+			if err := writeMatrix(fmt.Sprintf("%s_%s_%s.csv", prefix, q.suffix, m.kind), m.values); err != nil {
+				return exceeded, err
+			}
+		}
+		if q.suffix == "res" {
+			if err := writeFlips(prefix+"_res_flips.csv", a, b, c.Flips); err != nil {
+				return exceeded, err
+			}
+		}
+
+		if i := largest(c.Absolute); i >= 0 {
+			fmt.Printf("%s: largest difference %+.4f %s (%+.2f%%) at block %d",
+				q.label, c.Absolute[i], q.unit, 100*c.Relative[i], i)
+		} else {
+			fmt.Printf("%s: no pigment state is defined in both sets", q.label)
+		}
+		fmt.Printf(", %d of %d pigment states flip between defined and NaN\n", len(c.Flips), len(c.Absolute))
+		n := c.exceeded()
+		if n > 0 || len(c.Flips) > 0 {
+			if q.tol.checked() {
+				fmt.Printf("  %d pigment states outside the tolerance:\n", n)
+			}
+			printComparisonMap(c)
+		}
+		exceeded += n
+	}
+	return exceeded, nil
+}
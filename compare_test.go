@@ -0,0 +1,68 @@
+// FILE: compare_test.go
+// This file contains tests for the comparison of result sets in compare.go
+
+package main
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+func TestCompareMatrix(t *testing.T) {
+	a := []blockSummary{{FWHMDegrees: 10}, {FWHMDegrees: 10}, {FWHMDegrees: math.NaN()}, {FWHMDegrees: math.NaN()}, {FWHMDegrees: 0}}
+	b := []blockSummary{{FWHMDegrees: 10.05}, {FWHMDegrees: 12}, {FWHMDegrees: 5}, {FWHMDegrees: math.NaN()}, {FWHMDegrees: 0}}
+	value := func(s blockSummary) float64 { return s.FWHMDegrees }
+
+	c := compareMatrix(a, b, value, tolerance{Absolute: 0.1, Relative: -1})
+	if math.Abs(c.Absolute[1]-2) > 1e-12 || math.Abs(c.Relative[1]-0.2) > 1e-12 {
+		t.Errorf("Expected an absolute difference of 2 and relative 0.2, got %g and %g", c.Absolute[1], c.Relative[1])
+	}
+	if c.Relative[4] != 0 {
+		t.Errorf("Expected no relative difference between two zeros, got %g", c.Relative[4])
+	}
+	if len(c.Flips) != 1 || c.Flips[0] != 2 {
+		t.Errorf("Expected block 2 to flip from NaN to defined, got %v", c.Flips)
+	}
+	want := []bool{false, true, true, false, false}
+	for i := range want {
+		if c.Exceeds[i] != want[i] {
+			t.Errorf("Block %d: expected exceeds %t, got %t", i, want[i], c.Exceeds[i])
+		}
+	}
+
+	// Without a tolerance nothing is checked, so even a flip is only reported.
+	if n := compareMatrix(a, b, value, tolerance{-1, -1}).exceeded(); n != 0 {
+		t.Errorf("Expected nothing to exceed an unchecked tolerance, got %d", n)
+	}
+	if n := compareMatrix(a, b, value, tolerance{-1, 0.1}).exceeded(); n != 2 {
+		t.Errorf("Expected the 20%% change and the flip to exceed a 10%% tolerance, got %d", n)
+	}
+}
+
+// TestReadResultsJSON checks that the summaries read back from a results file match
+// those written, including the NaN resolution written as null.
+func TestReadResultsJSON(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_compare"))
+	summaries := model.simulate(nil)
+	summaries[7].FWHMDegrees = math.NaN()
+	if _, err := model.writeResultsJSON(summaries); err != nil {
+		t.Fatalf("writeResultsJSON returned an unexpected error: %v", err)
+	}
+	defer os.Remove("test_compare_results.json")
+
+	set, err := readResultsJSON("test_compare_results.json")
+	if err != nil {
+		t.Fatalf("readResultsJSON returned an unexpected error: %v", err)
+	}
+	if set.Name != "test_compare" {
+		t.Errorf("Expected the species name test_compare, got %q", set.Name)
+	}
+	c := compareMatrix(summaries, set.Summaries, resolutionHeatmap.Value, tolerance{0, 0})
+	if n := c.exceeded(); n != 0 {
+		t.Errorf("Expected the results to round-trip exactly, got %d differences", n)
+	}
+	if !math.IsNaN(set.Summaries[7].FWHMDegrees) {
+		t.Errorf("Expected a null resolution to read back as NaN, got %g", set.Summaries[7].FWHMDegrees)
+	}
+}
@@ -0,0 +1,65 @@
+// FILE: compat.go
+// This file contains the compatibility export, which writes the current results in
+// the layout and units of releases before 0.6 for tools that still expect them.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// writeLegacyPathlengthsLine writes one facet's line of a pre-0.6 pathlengths file:
+// its path lengths, with the facet transmission already folded in, separated by
+// commas, or a single 0 for a ray that entered no rhabdom.
+func writeLegacyPathlengthsLine(w io.Writer, folded []float64) error {
+	if len(folded) == 0 {
+		_, err := fmt.Fprintln(w, "0")
+		return err
+	}
+	parts := make([]string, len(folded))
+	for i, v := range folded {
+		parts[i] = strconv.FormatFloat(v, 'f', 6, 64)
+	}
+	_, err := fmt.Fprintln(w, strings.Join(parts, ","))
+	return err
+}
+
+// isCompatExport reports whether a pathlengths file is a compatibility export, by the
+// marker in its name. Its rays were traced with the current continuous blur offsets,
+// so the converter, which places rays at the legacy whole-rhabdom offsets, cannot read
+// it back.
+func isCompatExport(filename string) bool {
+	return strings.HasSuffix(filepath.Base(filename), "_compat_pathlengths.csv")
+}
+
+// compatSummary converts a current block summary into the pre-0.6 units: resolution
+// as int(200 × half-width) in centidegrees and sensitivity truncated to a whole
+// percentage. Earlier releases had no notion of an undefined acceptance angle, so a
+// state with none is written as 0.
+func compatSummary(s blockSummary) legacySummary {
+	out := legacySummary{
+		SensitivityPercent: s.SensitivityPercent,
+		Sensitivity:        int(s.SensitivityPercent),
+	}
+	if !math.IsNaN(s.FWHMDegrees) {
+		out.HalfWidthDegrees = s.FWHMDegrees / 2.0
+		out.Resolution = int(200.0 * out.HalfWidthDegrees)
+	}
+	return out
+}
+
+// writeCompatSummaries writes {species}_compat_summary_res.csv and
+// {species}_compat_summary_sen.csv: the current results in the pre-0.6 units. It
+// returns the names of the files.
+func (m *Model) writeCompatSummaries(summaries []blockSummary) ([]string, error) {
+	compat := make([]legacySummary, len(summaries))
+	for i, s := range summaries {
+		compat[i] = compatSummary(s)
+	}
+	return writeLegacySummaries(m.Params.SpeciesName+"_compat_summary", compat)
+}
@@ -0,0 +1,107 @@
+// FILE: compat_test.go
+// This file contains tests for the compatibility export in compat.go
+
+package main
+
+import (
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompatSummary(t *testing.T) {
+	got := compatSummary(blockSummary{FWHMDegrees: 9.5803, SensitivityPercent: 83.032})
+	if got.Resolution != 958 || got.Sensitivity != 83 {
+		t.Errorf("Expected 958 centidegrees and 83%%, got %d and %d", got.Resolution, got.Sensitivity)
+	}
+	got = compatSummary(blockSummary{FWHMDegrees: math.NaN(), SensitivityPercent: 12.9, Annular: true})
+	if got.Resolution != 0 || got.Sensitivity != 12 {
+		t.Errorf("Expected an undefined acceptance angle to be written as 0, got %d and %d",
+			got.Resolution, got.Sensitivity)
+	}
+}
+
+// TestCompatPathlengths checks that the compatibility pathlengths file reads back
+// through the legacy parser as the current trace with the transmission folded in.
+func TestCompatPathlengths(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_compat"))
+	model.CompatMode = true
+	if _, _, err := model.runModel(); err != nil {
+		t.Fatalf("runModel returned an unexpected error: %v", err)
+	}
+	defer os.Remove("test_compat_pathlengths.csv")
+	defer os.Remove("test_compat_compat_pathlengths.csv")
+
+	blocks, err := readLegacyPathlengths("test_compat_compat_pathlengths.csv", model.NumberOfFacets)
+	if err != nil {
+		t.Fatalf("The compatibility pathlengths did not parse: %v", err)
+	}
+	for _, block := range []int{0, 56, 120} {
+		shielding, tapetal := model.pigmentPositions(block)
+		for facet, got := range blocks[block] {
+			trace := model.traceRay(facet, shielding, tapetal)
+			if len(got) != len(trace.Pathlengths) {
+				t.Fatalf("Block %d facet %d: expected %d path lengths, got %d",
+					block, facet, len(trace.Pathlengths), len(got))
+			}
+			for i, v := range trace.Pathlengths {
+				if want := v * model.facetTransmission(facet); math.Abs(got[i]-want) > 1e-6 {
+					t.Errorf("Block %d facet %d rhabdom %d: expected %f, got %f", block, facet, i, want, got[i])
+				}
+			}
+		}
+	}
+}
+
+// TestConvertRefusesCompatExport checks that a compatibility export written by a run
+// is not converted as if it were traced with the legacy blur offsets, which would
+// give summaries that disagree with those exported beside it.
+func TestConvertRefusesCompatExport(t *testing.T) {
+	paramFile, err := filepath.Abs("example_data/nephrops_parameters.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	model, err := loadSpecies(paramFile, false, "nephropsfl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.CompatMode = true
+	if _, _, err := model.runModel(); err != nil {
+		t.Fatalf("runModel returned an unexpected error: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"-f", paramFile, "nephropsfl_compat_pathlengths.csv"},
+		{"-f", paramFile, "-species", "nephropsfl", "nephropsfl_compat_pathlengths.csv"},
+	} {
+		err := convertCommand(flag.NewFlagSet("convert", flag.ContinueOnError), args)
+		if err == nil || !strings.Contains(err.Error(), "compatibility export") {
+			t.Errorf("%v: expected the compatibility export to be refused, got %v", args, err)
+		}
+	}
+	if _, err := os.Stat("nephropsfl_converted_pathlengths.csv"); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be converted, got %v", err)
+	}
+}
+
+// TestCompatExportReportsWriteErrors checks that a failed write to the compatibility
+// pathlengths file fails the run, rather than leaving a truncated file to be
+// checksummed.
+func TestCompatExportReportsWriteErrors(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full to fail the writes")
+	}
+	t.Chdir(t.TempDir())
+	model := mustModel(t, nephropsFlatLateral("test_compat_full"))
+	model.CompatMode = true
+	if err := os.Symlink("/dev/full", "test_compat_full_compat_pathlengths.csv"); err != nil {
+		t.Skipf("cannot link to /dev/full: %v", err)
+	}
+	if _, _, err := model.runModel(); err == nil || !strings.Contains(err.Error(), "compatibility pathlengths") {
+		t.Errorf("Expected the failed write to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+// FILE: contrast.go
+// This file contains the photon noise model, which turns each pigment state's photon
+// catch into a signal-to-noise ratio and the smallest contrast it can detect, and
+// combines that with the modulation transfer function into contrast sensitivity.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// noiseHeader labels the columns of {species}_snr.csv.
+const noiseHeader = "block,shielding_step,tapetal_step,photons,shot_noise,dark_noise,snr,min_contrast"
+
+// contrastSensitivityHeader labels the columns of {species}_csf.csv.
+const contrastSensitivityHeader = "block,shielding_step,tapetal_step,frequency_cpd,mtf,contrast_sensitivity"
+
+// photonNoise is what limits how reliably a rhabdom can count photons.
+type photonNoise struct {
+	// Integration is the integration time of the photoreceptors, in seconds.
+	Integration float64
+	// DarkRate is the rate of thermal events indistinguishable from photons, per
+	// rhabdom per second.
+	DarkRate float64
+	// Reliability is how many standard deviations apart two signals must be to be told
+	// apart.
+	Reliability float64
+}
+
+// visualSignal is what one rhabdom counts in one integration time.
+type visualSignal struct {
+	// Photons is the mean number absorbed.
+	Photons float64
+	// ShotNoise and DarkNoise are the standard deviations of the photons and of the
+	// dark events, both Poisson.
+	ShotNoise, DarkNoise float64
+	// SNR is the signal-to-noise ratio.
+	SNR float64
+	// MinContrast is the smallest Michelson contrast between two rhabdoms that can be
+	// detected, or +Inf if no photons are absorbed.
+	MinContrast float64
+}
+
+// signal returns what a rhabdom absorbing photons at a rate, per second, counts. Two
+// neighbouring rhabdoms viewing a contrast C absorb N(1+C) and N(1-C), and are told
+// apart when that difference of 2CN is Reliability standard deviations of the
+// difference, sqrt(2) times the noise of either, so the smallest contrast is
+// Reliability sqrt(2) / (2 SNR).
+func (n photonNoise) signal(rate float64) visualSignal {
+	s := visualSignal{
+		Photons:   rate * n.Integration,
+		DarkNoise: math.Sqrt(n.DarkRate * n.Integration),
+	}
+	s.ShotNoise = math.Sqrt(s.Photons)
+	if s.Photons <= 0 {
+		s.MinContrast = math.Inf(1)
+		return s
+	}
+	s.SNR = s.Photons / math.Hypot(s.ShotNoise, s.DarkNoise)
+	s.MinContrast = n.Reliability * math.Sqrt2 / (2.0 * s.SNR)
+	return s
+}
+
+// mtf returns the modulation transfer function of a pigment state at a spatial
+// frequency in cycles per degree. The point spread function is circularly symmetric,
+// so the MTF is its Hankel transform, taking the light absorbed at each rhabdom offset
+// to lie at that offset's angle from the optic axis. It is negative where a wide blur
+// reverses the contrast, and zero for a state that absorbs no light.
+func (m *Model) mtf(s blockSummary, frequency float64) float64 {
+	total, transfer := 0.0, 0.0
+	for j, v := range s.PSF {
+		light := v * ringArea(j)
+		total += light
+		transfer += light * math.J0(2.0*math.Pi*frequency*float64(j)*m.OmmatidialAngle)
+	}
+	if total <= 0 {
+		return 0
+	}
+	return transfer / total
+}
+
+// nyquistFrequency is the highest spatial frequency, in cycles per degree, the array of
+// rhabdoms can resolve: one cycle every two ommatidial angles.
+func (m *Model) nyquistFrequency() float64 {
+	return 1.0 / (2.0 * m.OmmatidialAngle)
+}
+
+// writeContrast writes {species}_snr.csv, the photon catch and noise of each pigment
+// state under a photon radiance in photons/m²/sr/s, and {species}_csf.csv, its
+// contrast sensitivity at each spatial frequency: the size of the MTF over the smallest
+// contrast detectable, since reversed contrast is as visible as the original. It
+// returns the signals of the states.
+func (m *Model) writeContrast(summaries []blockSummary, photonRadiance float64, noise photonNoise,
+	frequencies []float64) ([]visualSignal, error) {
+	signals := make([]visualSignal, len(summaries))
+	for i, s := range summaries {
+		signals[i] = noise.signal(m.extendedCatch(s.SensitivityPercent, photonRadiance))
+	}
+
+	filename := fmt.Sprintf("%s_snr.csv", m.Params.SpeciesName)
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, noiseHeader)
+	for block, s := range signals {
+		if _, err := fmt.Fprintf(writer, "%d,%d,%d,%.6g,%.6g,%.6g,%.6g,%s\n", block, block/pigmentSteps,
+			block%pigmentSteps, s.Photons, s.ShotNoise, s.DarkNoise, s.SNR,
+			strconv.FormatFloat(s.MinContrast, 'g', 6, 64)); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", filename, err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, fmt.Errorf("writing %s: %w", filename, err)
+	}
+
+	filename = fmt.Sprintf("%s_csf.csv", m.Params.SpeciesName)
+	csf, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer csf.Close()
+	writer = bufio.NewWriter(csf)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, contrastSensitivityHeader)
+	for block, s := range summaries {
+		for _, f := range frequencies {
+			transfer := m.mtf(s, f)
+			if _, err := fmt.Fprintf(writer, "%d,%d,%d,%.4f,%.6f,%.6g\n", block, block/pigmentSteps,
+				block%pigmentSteps, f, transfer, math.Abs(transfer)/signals[block].MinContrast); err != nil {
+				return nil, fmt.Errorf("writing %s: %w", filename, err)
+			}
+		}
+	}
+	return signals, writer.Flush()
+}
+
+// printContrast prints the signal-to-noise ratio and smallest detectable contrast of
+// the dark- and light-adapted states.
+func printContrast(signals []visualSignal) {
+	for _, state := range adaptedStates(len(signals)) {
+		s := signals[state.Block]
+		fmt.Printf("Photon noise, %s: %.4g photons per integration time, SNR %.4g, smallest contrast %.4g\n",
+			state.Label, s.Photons, s.SNR, s.MinContrast)
+	}
+}
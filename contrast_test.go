@@ -0,0 +1,73 @@
+// FILE: contrast_test.go
+// This file contains tests for the photon noise model in contrast.go
+
+package main
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPhotonNoiseSignal(t *testing.T) {
+	s := photonNoise{Integration: 0.1, Reliability: 1}.signal(1000)
+	if s.Photons != 100 || s.ShotNoise != 10 || s.DarkNoise != 0 || math.Abs(s.SNR-10) > 1e-12 {
+		t.Errorf("Expected 100 photons with shot noise and SNR of 10, got %+v", s)
+	}
+	if want := math.Sqrt2 / 20; math.Abs(s.MinContrast-want) > 1e-12 {
+		t.Errorf("Expected a smallest contrast of %g, got %g", want, s.MinContrast)
+	}
+
+	dark := photonNoise{Integration: 0.1, DarkRate: 500, Reliability: 2}.signal(1000)
+	if math.Abs(dark.SNR-100/math.Sqrt(150)) > 1e-12 {
+		t.Errorf("Expected dark noise to add to the variance, got SNR %g", dark.SNR)
+	}
+	if want := 2 * math.Sqrt2 / (2 * dark.SNR); math.Abs(dark.MinContrast-want) > 1e-12 {
+		t.Errorf("Expected the reliability to scale the smallest contrast, got %g, want %g", dark.MinContrast, want)
+	}
+
+	if none := (photonNoise{Integration: 0.1, Reliability: 1}).signal(0); !math.IsInf(none.MinContrast, 1) {
+		t.Errorf("Expected no contrast to be detectable without photons, got %g", none.MinContrast)
+	}
+}
+
+// TestMTF checks the MTF is one at zero frequency, matches the Bessel function for
+// light all at one offset, and is zero for a state absorbing nothing.
+func TestMTF(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_mtf"))
+	if got := model.mtf(model.simulateState(0, 0, 0, nil), 0); math.Abs(got-1) > 1e-12 {
+		t.Errorf("Expected an MTF of 1 at zero frequency, got %g", got)
+	}
+	ring := blockSummary{PSF: []float64{0, 0, 1, 0}}
+	f := model.nyquistFrequency() / 3
+	if got, want := model.mtf(ring, f), math.J0(2*math.Pi*f*2*model.OmmatidialAngle); math.Abs(got-want) > 1e-12 {
+		t.Errorf("Expected %g for a ring of light, got %g", want, got)
+	}
+	if got := model.mtf(blockSummary{}, f); got != 0 {
+		t.Errorf("Expected an MTF of 0 without light, got %g", got)
+	}
+}
+
+func TestWriteContrast(t *testing.T) {
+	t.Chdir(t.TempDir())
+	model := mustModel(t, nephropsFlatLateral("test_contrast"))
+	summaries := model.simulate(nil)
+	noise := photonNoise{Integration: 0.1, DarkRate: 10, Reliability: 1}
+	signals, err := model.writeContrast(summaries, 1e14, noise, sweepValues(0, model.nyquistFrequency(), 5))
+	if err != nil {
+		t.Fatalf("writeContrast returned an unexpected error: %v", err)
+	}
+	if want := noise.signal(model.extendedCatch(summaries[0].SensitivityPercent, 1e14)); signals[0] != want {
+		t.Errorf("Expected the dark-adapted signal %+v, got %+v", want, signals[0])
+	}
+	for file, rows := range map[string]int{"test_contrast_snr.csv": len(summaries), "test_contrast_csf.csv": len(summaries) * 5} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != rows+1 {
+			t.Errorf("%s: expected %d rows, got %d", file, rows, len(lines)-1)
+		}
+	}
+}
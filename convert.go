@@ -0,0 +1,174 @@
+// FILE: convert.go
+// This file contains the converter for pathlengths files written by releases before
+// 0.6, which turns them into the current schema and recomputes their summaries.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// legacyPathlengthsTerminator closes each block of a pre-0.6 pathlengths file.
+const legacyPathlengthsTerminator = "999"
+
+// convertedPathlengthsHeader labels the converted pathlengths. The columns are those
+// of the current schema, with a final column recording that the facet transmission is
+// already folded into every value, so the file cannot be mistaken for raw geometry.
+const convertedPathlengthsHeader = pathlengthsHeader + ",transmission_folded"
+
+// readLegacyPathlengths parses a pre-0.6 pathlengths file. The file is positional:
+// each pigment state is a block of one line per facet, in facet order, listing the
+// path length through each rhabdom the ray entered, separated by commas or spaces,
+// and each block is closed by a line reading 999. A facet whose ray entered no
+// rhabdom has an empty line or a single 0. The result is indexed by block, facet and
+// rhabdom, with the values exactly as recorded.
+func readLegacyPathlengths(filename string, facets int) ([][][]float64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var blocks [][][]float64
+	var current [][]float64
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == legacyPathlengthsTerminator {
+			if len(current) != facets {
+				return nil, fmt.Errorf("%s: line %d: block %d has %d facets, expected %d",
+					filename, line, len(blocks), len(current), facets)
+			}
+			blocks = append(blocks, current)
+			current = nil
+			continue
+		}
+		if len(blocks) == pigmentSteps*pigmentSteps {
+			if text == "" {
+				continue
+			}
+			return nil, fmt.Errorf("%s: line %d: data after the last of %d blocks", filename, line, len(blocks))
+		}
+
+		fields := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		var values []float64
+		for _, f := range fields {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: line %d: %w", filename, line, err)
+			}
+			if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("%s: line %d: path length %s is not a non-negative number", filename, line, f)
+			}
+			values = append(values, v)
+		}
+		if len(values) == 1 && values[0] == 0 {
+			values = nil
+		}
+		current = append(current, values)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filename, err)
+	}
+	if len(current) > 0 {
+		return nil, fmt.Errorf("%s: block %d is not closed by %s", filename, len(blocks), legacyPathlengthsTerminator)
+	}
+	if len(blocks) != pigmentSteps*pigmentSteps {
+		return nil, fmt.Errorf("%s has %d blocks, expected %d", filename, len(blocks), pigmentSteps*pigmentSteps)
+	}
+	return blocks, nil
+}
+
+// writeConvertedPathlengths writes legacy path lengths in the current rectangular
+// schema, flagged as having the facet transmission folded in.
+func (m *Model) writeConvertedPathlengths(filename string, blocks [][][]float64) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, convertedPathlengthsHeader)
+	for block, facets := range blocks {
+		shielding, tapetal := m.pigmentPositions(block)
+		for facet, pathlengths := range facets {
+			if len(pathlengths) == 0 {
+				fmt.Fprintf(writer, "%d,%.6f,%.6f,%d,0,0.000000,true\n", block, shielding, tapetal, facet)
+			}
+			for rhabdom, v := range pathlengths {
+				if _, err := fmt.Fprintf(writer, "%d,%.6f,%.6f,%d,%d,%.6f,true\n",
+					block, shielding, tapetal, facet, rhabdom, v); err != nil {
+					return fmt.Errorf("writing %s: %w", filename, err)
+				}
+			}
+		}
+	}
+	return writer.Flush()
+}
+
+// summariseLegacyPathlengths recomputes the summaries of legacy path lengths, both as
+// the current model would summarise them and as the legacy algorithm did. The rays
+// were traced with the legacy blur offsets, so those offsets place them in the
+// profile; the transmission is already in the path lengths, so it is not applied
+// again. The legacy summaries reproduce the summary files written alongside the
+// original pathlengths file.
+func (m *Model) summariseLegacyPathlengths(blocks [][][]float64) ([]blockSummary, []legacySummary) {
+	summaries := make([]blockSummary, len(blocks))
+	legacy := make([]legacySummary, len(blocks))
+	for block, facets := range blocks {
+		var profile []float64
+		var lp legacyProfile
+		for facet, pathlengths := range facets {
+			profile = m.accumulateAt(profile, facet, float64(m.legacyBlurOffset(facet)), 1.0, pathlengths)
+			m.legacyAccumulate(&lp, facet, pathlengths)
+		}
+		summaries[block] = m.summariseBlock(profile)
+		summaries[block].Shielding, summaries[block].Tapetal = m.pigmentPositions(block)
+		legacy[block] = m.summariseLegacyBlock(lp)
+	}
+	return summaries, legacy
+}
+
+// convertLegacyPathlengths converts a legacy pathlengths file and writes, under the
+// given prefix, the converted pathlengths, the recomputed summary matrices and
+// results file, and the legacy integer matrices. It returns the files written.
+func (m *Model) convertLegacyPathlengths(filename, prefix string) ([]string, error) {
+	blocks, err := readLegacyPathlengths(filename, m.NumberOfFacets)
+	if err != nil {
+		return nil, err
+	}
+	summaries, legacy := m.summariseLegacyPathlengths(blocks)
+
+	written := []string{prefix + "_pathlengths.csv"}
+	if err := m.writeConvertedPathlengths(written[0], blocks); err != nil {
+		return nil, err
+	}
+	for _, q := range []struct {
+		suffix string
+		value  func(blockSummary) float64
+	}{
+		{"res", resolutionHeatmap.Value},
+		{"sen", sensitivityHeatmap.Value},
+	} {
+		name := fmt.Sprintf("%s_summary_%s.csv", prefix, q.suffix)
+		if err := writeSummaryMatrix(name, summaries, q.value); err != nil {
+			return written, err
+		}
+		written = append(written, name)
+	}
+	if err := m.writeResultsJSONTo(prefix+"_results.json", summaries); err != nil {
+		return written, err
+	}
+	written = append(written, prefix+"_results.json")
+	matrices, err := writeLegacySummaries(prefix+"_legacy_summary", legacy)
+	return append(written, matrices...), err
+}
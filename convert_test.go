@@ -0,0 +1,111 @@
+// FILE: convert_test.go
+// This file contains tests for the legacy pathlengths converter in convert.go
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeLegacyFixture writes a pathlengths file in the pre-0.6 layout, traced with the
+// legacy blur offsets and with the facet transmission folded in, as earlier releases
+// wrote it.
+func writeLegacyFixture(t *testing.T, m *Model, filename string) {
+	t.Helper()
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("Failed to create the fixture: %v", err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	for block := 0; block < pigmentSteps*pigmentSteps; block++ {
+		shielding, tapetal := m.pigmentPositions(block)
+		for facet := 0; facet < m.NumberOfFacets; facet++ {
+			trace := m.traceRayWithOffset(facet, shielding, tapetal, float64(m.legacyBlurOffset(facet)))
+			folded := make([]float64, len(trace.Pathlengths))
+			for i, v := range trace.Pathlengths {
+				folded[i] = v * m.facetTransmission(facet)
+			}
+			if err := writeLegacyPathlengthsLine(w, folded); err != nil {
+				t.Fatalf("Failed to write the fixture: %v", err)
+			}
+		}
+		w.WriteString("999\n")
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Failed to write the fixture: %v", err)
+	}
+}
+
+// TestConvertLegacyPathlengths checks that a legacy file converts to the current
+// schema, flagged as transmission-folded, and that the legacy summaries recomputed
+// from it match the legacy algorithm run directly.
+func TestConvertLegacyPathlengths(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_convert"))
+	dir := t.TempDir()
+	legacyFile := filepath.Join(dir, "test_convert_pathlengths.csv")
+	writeLegacyFixture(t, model, legacyFile)
+
+	prefix := filepath.Join(dir, "test_convert_converted")
+	written, err := model.convertLegacyPathlengths(legacyFile, prefix)
+	if err != nil {
+		t.Fatalf("convertLegacyPathlengths returned an unexpected error: %v", err)
+	}
+	if len(written) != 6 {
+		t.Errorf("Expected 6 files written, got %v", written)
+	}
+
+	data, err := os.ReadFile(prefix + "_pathlengths.csv")
+	if err != nil {
+		t.Fatalf("Failed to read the converted pathlengths: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if lines[0] != "block,shielding_um,tapetal_um,facet,rhabdom,pathlength_um,transmission_folded" {
+		t.Errorf("Unexpected header %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "0,0.000000,0.000000,0,0,") || !strings.HasSuffix(lines[1], ",true") {
+		t.Errorf("Unexpected first row %q", lines[1])
+	}
+
+	blocks, err := readLegacyPathlengths(legacyFile, model.NumberOfFacets)
+	if err != nil {
+		t.Fatalf("readLegacyPathlengths returned an unexpected error: %v", err)
+	}
+	_, legacy := model.summariseLegacyPathlengths(blocks)
+	want := model.simulateLegacy()
+	for block := range want {
+		if legacy[block].Resolution != want[block].Resolution || legacy[block].Sensitivity != want[block].Sensitivity {
+			t.Fatalf("Block %d: recomputed %+v, legacy algorithm %+v", block, legacy[block], want[block])
+		}
+	}
+	if legacy[0].Resolution != 833 || legacy[0].Sensitivity != 78 {
+		t.Errorf("Expected 833 and 78 recomputed for the dark-adapted state, got %d and %d",
+			legacy[0].Resolution, legacy[0].Sensitivity)
+	}
+}
+
+func TestReadLegacyPathlengthsRejectsMalformedFiles(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, content string
+	}{
+		{"short block", "180\n999\n"},
+		{"unterminated", "180\n180\n"},
+		{"bad value", "180\nabc\n999\n"},
+		{"negative", "180\n-1\n999\n"},
+		{"too few blocks", "180\n180\n999\n"},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_"))
+		if err := os.WriteFile(filename, []byte(tt.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readLegacyPathlengths(filename, 2); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
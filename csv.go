@@ -6,6 +6,7 @@ package main
 import (
 	"bufio"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -33,6 +34,12 @@ func ringArea(offset int) float64 {
 	return outer - inner
 }
 
+// patchArea is the area of the eyeshine patch in the units of ringArea: the sum of
+// every facet's annulus, which telescopes to pi*(N-0.5)^2.
+func (m *Model) patchArea() float64 {
+	return math.Pi * math.Pow(float64(m.NumberOfFacets)-0.5, 2)
+}
+
 // deposit adds an amount at the given offset, growing the slice as required. Earlier
 // versions used a fixed 21-element array and silently discarded everything beyond it,
 // which lost up to a quarter of the absorbed light for widely blurred eyes.
@@ -49,6 +56,13 @@ func deposit(dst []float64, offset int, amount float64) []float64 {
 
 // blockSummary holds the resolution and sensitivity derived from one pigment block.
 type blockSummary struct {
+	// Shielding and Tapetal are the pigment positions of the block, as their extent
+	// in micrometres from the proximal end of the rhabdom.
+	Shielding float64
+	Tapetal   float64
+	// LostRays counts the rays in the block that stopped propagating towards the
+	// proximal end.
+	LostRays int
 	// FWHMDegrees is the acceptance angle: the full width at half maximum of the
 	// angular sensitivity function, in degrees. NaN when the profile carries no light
 	// or is annular, in which case there is no acceptance angle to report.
@@ -60,6 +74,33 @@ type blockSummary struct {
 	// Annular is set when the profile dips below half its maximum on the optic axis,
 	// so the light forms a ring rather than a central spot.
 	Annular bool
+	// PSF is the light per unit area at each rhabdom offset from the optic axis, ending
+	// with the first dark offset. It is empty when the block absorbs no light.
+	PSF []float64
+	// Budget accounts for all the light incident on the eyeshine patch.
+	Budget energyBudget
+	// Depth is the percentage of the incident light absorbed in each bin of depth from
+	// the distal tip, summed over every rhabdom.
+	Depth []float64
+	// Cases counts the rays in the block by the terminal case that ended their trace.
+	Cases map[string]int
+	// MeanRhabdoms is the mean number of rhabdoms each ray entered, counting lost rays
+	// as entering none.
+	MeanRhabdoms float64
+	// MaxAngle is the largest angle to the rhabdom axis any ray reached, in degrees.
+	MaxAngle float64
+}
+
+// adaptedState is a pigment state the commands report on by name.
+type adaptedState struct {
+	Label string
+	Block int
+}
+
+// adaptedStates returns the dark-adapted state, with neither pigment extended, and the
+// light-adapted state, with both fully extended, of a grid of n pigment states.
+func adaptedStates(n int) []adaptedState {
+	return []adaptedState{{"dark-adapted", 0}, {"light-adapted", n - 1}}
 }
 
 // summariseBlock converts one block's area-weighted absorption profile into
@@ -74,9 +115,8 @@ func (m *Model) summariseBlock(rhabdoms []float64) blockSummary {
 	for _, v := range rhabdoms {
 		total += v
 	}
-	patchArea := math.Pi * math.Pow(float64(m.NumberOfFacets)-0.5, 2)
-	if patchArea > 0 {
-		out.SensitivityPercent = total / patchArea
+	if area := m.patchArea(); area > 0 {
+		out.SensitivityPercent = total / area
 	}
 
 	if len(rhabdoms) == 0 {
@@ -95,6 +135,7 @@ func (m *Model) summariseBlock(rhabdoms []float64) blockSummary {
 	for j := range rhabdoms {
 		psf[j] = rhabdoms[j] / ringArea(j)
 	}
+	out.PSF = psf
 
 	peak := 0
 	for j, v := range psf {
@@ -132,24 +173,79 @@ func (m *Model) summariseBlock(rhabdoms []float64) blockSummary {
 	return out
 }
 
+// warnings describes the pigment states whose results need care in interpreting:
+// rays lost from the trace, annular profiles and blocks that absorb no light.
+func (m *Model) warnings(summaries []blockSummary) []string {
+	var out []string
+	lost, dark, annular, unbalanced := 0, 0, 0, 0
+	for _, s := range summaries {
+		lost += s.LostRays
+		if !s.balanced() {
+			unbalanced++
+		}
+		switch {
+		case s.Annular:
+			annular++
+		case math.IsNaN(s.FWHMDegrees):
+			dark++
+		}
+	}
+	if lost > 0 {
+		out = append(out, fmt.Sprintf("%d of %d rays exceeded 90 degrees to the rhabdom axis and were discarded.",
+			lost, len(summaries)*m.NumberOfFacets))
+	}
+	if annular > 0 {
+		out = append(out, fmt.Sprintf("%d of %d pigment states have an annular profile, with the light "+
+			"forming a ring rather than a central spot; they have no acceptance angle and are "+
+			"reported as NaN.", annular, len(summaries)))
+	}
+	if dark > 0 {
+		out = append(out, fmt.Sprintf("%d of %d pigment states absorb no light; their resolution is "+
+			"reported as NaN.", dark, len(summaries)))
+	}
+	if unbalanced > 0 {
+		out = append(out, fmt.Sprintf("%d of %d pigment states have an energy budget that does not account "+
+			"for all the incident light, or that absorbs a different amount than their sensitivity reports.",
+			unbalanced, len(summaries)))
+	}
+	return out
+}
+
 // accumulate adds one facet's traced ray into the area-weighted absorption profile,
 // which records how much light reaches each whole-rhabdom offset from the optic axis.
 func (m *Model) accumulate(profile []float64, facetIndex int, pathlengths []float64) []float64 {
+	return m.accumulateAt(profile, facetIndex, m.blurOffset(facetIndex), m.facetTransmission(facetIndex), pathlengths)
+}
+
+// absorption returns the fraction of the light entering a ray that each rhabdom along
+// it absorbs, each taking its Beer-Lambert share of the light still travelling, and
+// the fraction that passes through them all.
+func absorption(pathlengths []float64) (absorbed []float64, remaining float64) {
+	absorbed = make([]float64, len(pathlengths))
+	remaining = 1.0
+	for i, pathlength := range pathlengths {
+		if pathlength <= 0 {
+			continue
+		}
+		absorbed[i] = remaining * (1.0 - math.Exp(-absorptionCoefficient*pathlength))
+		remaining -= absorbed[i]
+	}
+	return absorbed, remaining
+}
+
+// accumulateAt adds a traced ray into the profile with the given blur offset and facet
+// transmission, for path lengths traced or recorded under other assumptions.
+func (m *Model) accumulateAt(profile []float64, facetIndex int, offset, transmission float64, pathlengths []float64) []float64 {
 	// Light gathered by this facet, and the rhabdom offset its image lands on.
-	transmission := m.facetTransmission(facetIndex)
 	sourceArea := ringArea(facetIndex)
-	offset := m.blurOffset(facetIndex)
 	base := int(math.Floor(offset))
 	frac := offset - float64(base)
 
-	tot := 0.0
-	for rhabdom, pathlength := range pathlengths {
-		if pathlength <= 0 {
+	fractions, _ := absorption(pathlengths)
+	for rhabdom, absorbed := range fractions {
+		if absorbed <= 0 {
 			continue
 		}
-		// Fraction of the light still travelling that this rhabdom absorbs.
-		absorbed := (1.0 - tot) * (1.0 - math.Exp(-absorptionCoefficient*pathlength))
-		tot += absorbed
 		// Facet transmission attenuates the flux entering the eye; it does not shorten
 		// the geometric path, so it multiplies the absorbed intensity rather than the
 		// exponent.
@@ -166,48 +262,53 @@ func (m *Model) accumulate(profile []float64, facetIndex int, pathlengths []floa
 }
 
 // calculateRessens writes the resolution and sensitivity matrices for the pigment
-// states accumulated during the simulation.
-func (m *Model) calculateRessens(summaries []blockSummary) error {
+// states accumulated during the simulation, and returns the names of the files.
+func (m *Model) calculateRessens(summaries []blockSummary) ([]string, error) {
 	p := m.Params
 	fmt.Println("INFO: Calculating resolution and sensitivity...")
 
 	if len(summaries) != pigmentSteps*pigmentSteps {
-		return fmt.Errorf("expected %d pigment states, got %d", pigmentSteps*pigmentSteps, len(summaries))
+		return nil, fmt.Errorf("expected %d pigment states, got %d", pigmentSteps*pigmentSteps, len(summaries))
 	}
 
-	if err := writeSummaryMatrix(fmt.Sprintf("%s_summary_res.csv", p.SpeciesName), summaries,
+	resFile := fmt.Sprintf("%s_summary_res.csv", p.SpeciesName)
+	if err := writeSummaryMatrix(resFile, summaries,
 		func(b blockSummary) float64 { return b.FWHMDegrees }); err != nil {
-		return err
+		return nil, err
 	}
-	if err := writeSummaryMatrix(fmt.Sprintf("%s_summary_sen.csv", p.SpeciesName), summaries,
+	senFile := fmt.Sprintf("%s_summary_sen.csv", p.SpeciesName)
+	if err := writeSummaryMatrix(senFile, summaries,
 		func(b blockSummary) float64 { return b.SensitivityPercent }); err != nil {
-		return err
+		return nil, err
 	}
 
-	dark, annular := 0, 0
-	for _, s := range summaries {
-		switch {
-		case s.Annular:
-			annular++
-		case math.IsNaN(s.FWHMDegrees):
-			dark++
-		}
-	}
-	if annular > 0 {
-		fmt.Printf("WARNING: %d of %d pigment states have an annular profile, with the light "+
-			"forming a ring rather than a central spot; they have no acceptance angle and are "+
-			"reported as NaN.\n", annular, len(summaries))
+	for _, w := range m.warnings(summaries) {
+		fmt.Printf("WARNING: %s\n", w)
 	}
-	if dark > 0 {
-		fmt.Printf("WARNING: %d of %d pigment states absorb no light; their resolution is "+
-			"reported as NaN.\n", dark, len(summaries))
-	}
-	return nil
+	return []string{resFile, senFile}, nil
 }
 
 // writeSummaryMatrix writes an 11x11 matrix with shielding pigment position varying
 // down the rows and tapetal pigment position across the columns.
 func writeSummaryMatrix(filename string, summaries []blockSummary, value func(blockSummary) float64) error {
+	values := make([]float64, len(summaries))
+	for i, s := range summaries {
+		values[i] = value(s)
+	}
+	return writeMatrix(filename, values)
+}
+
+// writeMatrix writes one value per block as an 11x11 matrix, laid out like the summary
+// matrices.
+func writeMatrix(filename string, values []float64) error {
+	return writeFormattedMatrix(filename, values, func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 4, 64)
+	})
+}
+
+// writeFormattedMatrix is writeMatrix for values that need another format, such as
+// those spanning many orders of magnitude.
+func writeFormattedMatrix(filename string, values []float64, format func(float64) string) error {
 	file, err := os.Create(filename)
 	if err != nil {
 		return fmt.Errorf("creating %s: %w", filename, err)
@@ -219,7 +320,7 @@ func writeSummaryMatrix(filename string, summaries []blockSummary, value func(bl
 	for row := 0; row < pigmentSteps; row++ {
 		cells := make([]string, pigmentSteps)
 		for col := 0; col < pigmentSteps; col++ {
-			cells[col] = strconv.FormatFloat(value(summaries[row*pigmentSteps+col]), 'f', 4, 64)
+			cells[col] = format(values[row*pigmentSteps+col])
 		}
 		if _, err := fmt.Fprintln(writer, strings.Join(cells, ",")); err != nil {
 			return fmt.Errorf("writing %s: %w", filename, err)
@@ -228,71 +329,206 @@ func writeSummaryMatrix(filename string, summaries []blockSummary, value func(bl
 	return writer.Flush()
 }
 
-// parseInputParameters reads a parameter file using Go's standard CSV reader.
-// It returns a slice of parsed parameters and an error if parsing fails.
-func parseInputParameters(filename string) ([]Parameters, error) {
-	var paramsList []Parameters // A slice to hold multiple parameter sets
+// speciesResult pairs a simulated model with the summary of each of its pigment
+// states, for outputs that span every species in a run.
+type speciesResult struct {
+	Model     *Model
+	Summaries []blockSummary
+}
+
+// summaryLongHeader labels the columns of the tidy cross-species summary.
+const summaryLongHeader = "species,block,shielding_um,tapetal_um,shielding_fraction,tapetal_fraction," +
+	"fwhm_deg,sensitivity_pct,annular,peak_offset"
+
+// writeSummaryLong writes one row per species and pigment state, so that results
+// from every species in a run can be faceted or compared without stitching matrices
+// together.
+func writeSummaryLong(filename string, results []speciesResult) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
 
+	fmt.Fprintln(writer, summaryLongHeader)
+	for _, r := range results {
+		length := r.Model.Params.RhabdomLength
+		for block, s := range r.Summaries {
+			if _, err := fmt.Fprintf(writer, "%s,%d,%.6f,%.6f,%.4f,%.4f,%s,%s,%t,%d\n",
+				r.Model.Params.SpeciesName, block, s.Shielding, s.Tapetal,
+				s.Shielding/length, s.Tapetal/length,
+				strconv.FormatFloat(s.FWHMDegrees, 'f', 4, 64),
+				strconv.FormatFloat(s.SensitivityPercent, 'f', 4, 64),
+				s.Annular, s.PeakOffset); err != nil {
+				return fmt.Errorf("writing %s: %w", filename, err)
+			}
+		}
+	}
+	return writer.Flush()
+}
+
+// parameterRecord is one row of a parameter file that parsed successfully.
+type parameterRecord struct {
+	// Line is the line of the file the row starts on, counting from 1.
+	Line   int
+	Params Parameters
+}
+
+// recordError describes a row of a parameter file that could not be parsed.
+type recordError struct {
+	Line int
+	// Species is the first field of the row, if it could be read.
+	Species string
+	// Field is the Parameters field at fault, or empty when the row as a whole is
+	// malformed.
+	Field string
+	Err   error
+}
+
+func (e *recordError) Error() string {
+	where := fmt.Sprintf("line %d", e.Line)
+	if e.Species != "" {
+		where += fmt.Sprintf(" (%s)", e.Species)
+	}
+	if e.Field != "" {
+		where += ", " + e.Field
+	}
+	return fmt.Sprintf("%s: %v", where, e.Err)
+}
+
+func (e *recordError) Unwrap() error { return e.Err }
+
+// skippedRecords groups the problems of a parameter file by the line they were found
+// on, in order of line, so each malformed record can be reported once.
+func skippedRecords(problems []*recordError) [][]*recordError {
+	var groups [][]*recordError
+	index := map[int]int{}
+	for _, problem := range problems {
+		i, ok := index[problem.Line]
+		if !ok {
+			i = len(groups)
+			index[problem.Line] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], problem)
+	}
+	return groups
+}
+
+// describeRecord describes the problems found on one line of a parameter file, naming
+// the line and species once and then each problem, by its field where it has one.
+func describeRecord(problems []*recordError) string {
+	where := fmt.Sprintf("line %d", problems[0].Line)
+	if problems[0].Species != "" {
+		where += fmt.Sprintf(" (%s)", problems[0].Species)
+	}
+	details := make([]string, len(problems))
+	for i, problem := range problems {
+		details[i] = problem.Err.Error()
+		if problem.Field != "" {
+			details[i] = problem.Field + ": " + details[i]
+		}
+	}
+	return where + ": " + strings.Join(details, "; ")
+}
+
+// parameterFileFields is the number of fields in each row of a parameter file: the
+// species name followed by the numeric parameters.
+var parameterFileFields = 1 + len(parameterFields)
+
+// readParameterFile reads every row of a parameter file. Rows that parse are returned
+// with the line they came from; every row that does not yields a recordError, and a
+// row with several non-numeric fields yields one for each, so a caller can report
+// the whole file at once. The error is reserved for failures to read the file itself.
+func readParameterFile(filename string) ([]parameterRecord, []*recordError, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		return nil, fmt.Errorf("could not open parameter file %s: %w", filename, err)
+		return nil, nil, fmt.Errorf("could not open parameter file %s: %w", filename, err)
 	}
 	defer file.Close()
 
+	var records []parameterRecord
+	var problems []*recordError
+
 	reader := csv.NewReader(file)
+	// Field counts are checked below, so that a short row is reported alongside
+	// the others rather than fixing the expected width from whichever row is first.
+	reader.FieldsPerRecord = -1
 	for {
 		record, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
-		// Check for a specific parsing error (like wrong number of fields)
-		if parseErr, ok := err.(*csv.ParseError); ok && parseErr.Err == csv.ErrFieldCount {
-			log.Printf("Skipping malformed record on line %d: %v", parseErr.Line, err)
-			continue // Skip to the next record
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			problems = append(problems, &recordError{Line: parseErr.StartLine, Err: parseErr.Err})
+			continue
 		}
 		if err != nil {
-			return nil, fmt.Errorf("error reading CSV record: %w", err)
+			return nil, nil, fmt.Errorf("error reading CSV record: %w", err)
 		}
+		line, _ := reader.FieldPos(0)
+		species := strings.TrimSpace(record[0])
 
-		if len(record) != 10 {
-			log.Printf("Skipping malformed record (expected 10 fields, got %d): %v", len(record), record)
+		if len(record) != parameterFileFields {
+			problems = append(problems, &recordError{Line: line, Species: species,
+				Err: fmt.Errorf("expected %d fields, got %d", parameterFileFields, len(record))})
 			continue
 		}
 
-		var params Parameters
 		// (sn, rl, rw, ed, fw, ad, cri, rri, bce, pra)
-		numbers := make([]float64, 9)
+		params := Parameters{SpeciesName: species}
 		bad := false
-		for i := 1; i < 10; i++ {
-			v, err := strconv.ParseFloat(strings.TrimSpace(record[i]), 64)
+		for i, field := range parameterFields {
+			v, err := strconv.ParseFloat(strings.TrimSpace(record[i+1]), 64)
 			if err != nil {
-				log.Printf("Skipping record %q: field %d (%q) is not a number", record[0], i+1, record[i])
+				problems = append(problems, &recordError{Line: line, Species: species, Field: field.Name,
+					Err: fmt.Errorf("field %d (%q) is not a number", i+2, record[i+1])})
 				bad = true
-				break
+				continue
 			}
-			numbers[i-1] = v
+			*field.Value(&params) = v
 		}
 		if bad {
 			continue
 		}
 
-		params.SpeciesName = strings.TrimSpace(record[0])
-		params.RhabdomLength = numbers[0]
-		params.RhabdomWidth = numbers[1]
-		params.EyeDiameter = numbers[2]
-		params.FacetWidth = numbers[3]
-		params.ApertureDiameter = numbers[4]
-		params.CytoplasmRefractiveIndex = numbers[5]
-		params.RhabdomRefractiveIndex = numbers[6]
-		params.BlurCircleExtent = numbers[7]
-		params.ProximalRhabdomAngle = numbers[8]
+		records = append(records, parameterRecord{Line: line, Params: params})
+	}
+	return records, problems, nil
+}
 
-		paramsList = append(paramsList, params)
+// parseInputParameters reads a parameter file using Go's standard CSV reader.
+// It returns a slice of parsed parameters and an error if parsing fails.
+//
+// Rows that cannot be parsed are logged and skipped, unless strict is set, in which
+// case any such row fails the whole parse. Automated runs use strict parsing so that
+// a typo cannot silently drop a species from the results.
+func parseInputParameters(filename string, strict bool) ([]Parameters, error) {
+	records, problems, err := readParameterFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if strict && len(problems) > 0 {
+		errs := make([]error, len(problems))
+		for i, problem := range problems {
+			errs[i] = problem
+		}
+		return nil, fmt.Errorf("%d malformed records in %s:\n%w", len(skippedRecords(problems)), filename,
+			errors.Join(errs...))
+	}
+	for _, record := range skippedRecords(problems) {
+		log.Printf("Skipping malformed record on %s", describeRecord(record))
 	}
 
-	if len(paramsList) == 0 {
+	if len(records) == 0 {
 		return nil, fmt.Errorf("no valid parameter data found in %s", filename)
 	}
 
+	paramsList := make([]Parameters, len(records)) // A slice to hold multiple parameter sets
+	for i, r := range records {
+		paramsList[i] = r.Params
+	}
 	return paramsList, nil
 }
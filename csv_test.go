@@ -4,8 +4,12 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"log"
 	"math"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -16,7 +20,7 @@ func TestParseInputParameters(t *testing.T) {
 	t.Run("ValidFile", func(t *testing.T) {
 		content := `test_species1,100,10,1000,20,500,1.3,1.4,10,0
 test_species2,200,20,2000,40,1000,1.5,1.6,20,1`
-		paramsList, err := parseInputParameters(writeTempFile(t, content))
+		paramsList, err := parseInputParameters(writeTempFile(t, content), false)
 		if err != nil {
 			t.Errorf("parseInputParameters() returned an unexpected error: %v", err)
 		}
@@ -35,7 +39,7 @@ test_species2,200,20,2000,40,1000,1.5,1.6,20,1`
 	})
 
 	t.Run("NonExistentFile", func(t *testing.T) {
-		if _, err := parseInputParameters("non_existent_file.csv"); err == nil {
+		if _, err := parseInputParameters("non_existent_file.csv", false); err == nil {
 			t.Error("parseInputParameters() was expected to return an error for a non-existent file")
 		}
 	})
@@ -43,7 +47,7 @@ test_species2,200,20,2000,40,1000,1.5,1.6,20,1`
 	t.Run("MalformedFile", func(t *testing.T) {
 		content := `good_species,1,1,1,1,1,1,1,1,1
 bad_species,1,1`
-		paramsList, err := parseInputParameters(writeTempFile(t, content))
+		paramsList, err := parseInputParameters(writeTempFile(t, content), false)
 		if err != nil {
 			t.Errorf("parseInputParameters() returned an unexpected error: %v", err)
 		}
@@ -57,7 +61,7 @@ bad_species,1,1`
 	t.Run("NonNumericField", func(t *testing.T) {
 		content := `good_species,100,10,1000,20,500,1.3,1.4,10,0
 bad_species,100,10,1000,20,500,1.3,1.4,not_a_number,0`
-		paramsList, err := parseInputParameters(writeTempFile(t, content))
+		paramsList, err := parseInputParameters(writeTempFile(t, content), false)
 		if err != nil {
 			t.Errorf("parseInputParameters() returned an unexpected error: %v", err)
 		}
@@ -68,6 +72,63 @@ bad_species,100,10,1000,20,500,1.3,1.4,not_a_number,0`
 			t.Errorf("Expected 'good_species', got '%s'", paramsList[0].SpeciesName)
 		}
 	})
+
+	// A record with several bad fields is skipped with one warning listing them all.
+	t.Run("OneWarningPerRecord", func(t *testing.T) {
+		content := `good_species,100,10,1000,20,500,1.3,1.4,10,0
+typo_species,100,x,1000,20,500,1.3,1.4,y,0
+short_species,1,1`
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		defer log.SetOutput(os.Stderr)
+		if _, err := parseInputParameters(writeTempFile(t, content), false); err != nil {
+			t.Fatalf("parseInputParameters() returned an unexpected error: %v", err)
+		}
+		warnings := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(warnings) != 2 {
+			t.Fatalf("Expected one warning per skipped record, got %d:\n%s", len(warnings), buf.String())
+		}
+		want := `Skipping malformed record on line 2 (typo_species): RhabdomWidth: field 3 ("x") is not a number; ` +
+			`BlurCircleExtent: field 9 ("y") is not a number`
+		if !strings.HasSuffix(warnings[0], want) {
+			t.Errorf("Expected the first warning to end %q, got %q", want, warnings[0])
+		}
+		if !strings.HasSuffix(warnings[1], "line 3 (short_species): expected 10 fields, got 3") {
+			t.Errorf("Expected the second warning to name the short record, got %q", warnings[1])
+		}
+	})
+}
+
+// TestParseInputParametersStrict checks that strict parsing fails the whole file on
+// any malformed record, naming the line and field, rather than dropping the species.
+func TestParseInputParametersStrict(t *testing.T) {
+	content := `good_species,100,10,1000,20,500,1.3,1.4,10,0
+short_species,1,1
+typo_species,100,10,1000,20,500,1.3,1.4,not_a_number,0`
+	paramsList, err := parseInputParameters(writeTempFile(t, content), true)
+	if err == nil {
+		t.Fatalf("Expected strict parsing to fail, got %d records", len(paramsList))
+	}
+	for _, want := range []string{
+		"2 malformed records",
+		"line 2 (short_species): expected 10 fields, got 3",
+		`line 3 (typo_species), BlurCircleExtent: field 9 ("not_a_number") is not a number`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to contain %q, got: %v", want, err)
+		}
+	}
+
+	var recErr *recordError
+	if !errors.As(err, &recErr) || recErr.Line != 2 {
+		t.Errorf("Expected the error to unwrap to the record error on line 2, got %v", err)
+	}
+
+	// A clean file parses the same either way.
+	clean := `good_species,100,10,1000,20,500,1.3,1.4,10,0`
+	if paramsList, err := parseInputParameters(writeTempFile(t, clean), true); err != nil || len(paramsList) != 1 {
+		t.Errorf("Expected strict parsing of a clean file to succeed, got %d records and %v", len(paramsList), err)
+	}
 }
 
 func writeTempFile(t *testing.T, content string) string {
@@ -275,7 +336,7 @@ func TestCalculateRessensWritesMatrices(t *testing.T) {
 	for i := range summaries {
 		summaries[i] = blockSummary{FWHMDegrees: float64(i), SensitivityPercent: float64(i) / 2}
 	}
-	if err := model.calculateRessens(summaries); err != nil {
+	if _, err := model.calculateRessens(summaries); err != nil {
 		t.Fatalf("calculateRessens returned an unexpected error: %v", err)
 	}
 	defer os.Remove("test_write_summary_res.csv")
@@ -299,7 +360,7 @@ func TestCalculateRessensWritesMatrices(t *testing.T) {
 
 	// A short or long slice means the caller and the writer disagree about the matrix
 	// shape, which must be an error rather than a partially written file.
-	if err := model.calculateRessens(summaries[:5]); err == nil {
+	if _, err := model.calculateRessens(summaries[:5]); err == nil {
 		t.Error("Expected an error for the wrong number of pigment states")
 	}
 }
@@ -311,11 +372,11 @@ func TestSummaryMatricesAreUsable(t *testing.T) {
 	params := nephropsFlatLateral("test_matrix")
 	model := mustModel(t, params)
 
-	summaries, err := model.runModel()
+	summaries, _, err := model.runModel()
 	if err != nil {
 		t.Fatalf("runModel failed: %v", err)
 	}
-	if err := model.calculateRessens(summaries); err != nil {
+	if _, err := model.calculateRessens(summaries); err != nil {
 		t.Fatalf("calculateRessens failed: %v", err)
 	}
 	defer os.Remove("test_matrix_pathlengths.csv")
@@ -352,6 +413,45 @@ func TestSummaryMatricesAreUsable(t *testing.T) {
 	}
 }
 
+// TestWriteSummaryLong checks the tidy cross-species table: one row per species and
+// pigment state, with the pigment positions given both in micrometres and as a
+// fraction of the rhabdom length so that species with different rhabdoms line up.
+func TestWriteSummaryLong(t *testing.T) {
+	short := singleFacetModel(t, "test_short")
+	long := mustModel(t, nephropsFlatLateral("test_long"))
+	results := []speciesResult{
+		{Model: short, Summaries: short.simulate(nil)},
+		{Model: long, Summaries: long.simulate(nil)},
+	}
+	results[0].Summaries[3].FWHMDegrees = math.NaN()
+
+	filename := filepath.Join(t.TempDir(), "summary_long.csv")
+	if err := writeSummaryLong(filename, results); err != nil {
+		t.Fatalf("writeSummaryLong returned an unexpected error: %v", err)
+	}
+	lines := readLines(t, filename)
+	if lines[0] != summaryLongHeader {
+		t.Fatalf("Expected the header %q, got %q", summaryLongHeader, lines[0])
+	}
+	if want := 1 + 2*pigmentSteps*pigmentSteps; len(lines) != want {
+		t.Fatalf("Expected %d rows, got %d", want, len(lines))
+	}
+
+	columns := len(strings.Split(summaryLongHeader, ","))
+	for i, line := range lines[1:] {
+		if fields := strings.Split(line, ","); len(fields) != columns {
+			t.Fatalf("Row %d: expected %d fields, got %d: %q", i, columns, len(fields), line)
+		}
+	}
+	if !strings.HasPrefix(lines[4], "test_short,3,0.000000,30.000000,0.0000,0.3000,NaN,") {
+		t.Errorf("Expected the short-rhabdom block 3 at tapetal fraction 0.3 with a NaN width, got %q", lines[4])
+	}
+	// Block 23 of the 180 um rhabdom: shielding step 2, tapetal step 1.
+	if row := lines[1+pigmentSteps*pigmentSteps+23]; !strings.HasPrefix(row, "test_long,23,36.000000,18.000000,0.2000,0.1000,") {
+		t.Errorf("Expected block 23 at fractions 0.2 and 0.1, got %q", row)
+	}
+}
+
 func readMatrix(t *testing.T, filename string) [][]float64 {
 	t.Helper()
 	data, err := os.ReadFile(filename)
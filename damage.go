@@ -0,0 +1,225 @@
+// FILE: damage.go
+// This file contains the photic damage model, which accumulates the photons absorbed
+// at each depth along the rhabdom over a light exposure regime and flags the doses
+// that exceed damage thresholds.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	planckConstant = 6.62607015e-34 // J s
+	speedOfLight   = 2.99792458e8   // m/s
+)
+
+// exposureRegimeColumns is the layout of an exposure regime file, as its header.
+const exposureRegimeColumns = "duration_s,irradiance_w_m2,band_from_nm,band_to_nm,shielding_fraction,tapetal_fraction"
+
+// damageHeader labels the columns of the damage output.
+const damageHeader = "interval,start_s,end_s,shielding_fraction,tapetal_fraction,irradiance_w_m2,band_from_nm,band_to_nm," +
+	"depth_from_um,depth_to_um,rate_photons_per_um3_s,dose_photons_per_um3,thresholds_exceeded"
+
+// exposureInterval is one step of an exposure regime: light of a constant irradiance,
+// within a band of wavelengths, for a time over which the pigments hold still.
+type exposureInterval struct {
+	// Line is the line of the regime file it was read from.
+	Line int
+	// Duration is in seconds.
+	Duration float64
+	// Irradiance is the power in the band falling on the eye, in W/m².
+	Irradiance float64
+	// BandFrom and BandTo are the limits of the band, in nanometres.
+	BandFrom, BandTo float64
+	// Shielding and Tapetal are the pigment positions, as fractions of the rhabdom
+	// length. They need not fall on the grid of blocks.
+	Shielding, Tapetal float64
+}
+
+// readExposureRegime parses an exposure regime file: one interval per line, in the
+// order of exposureRegimeColumns, with an optional header. Blank lines and lines
+// starting with # are ignored.
+func readExposureRegime(filename string) ([]exposureInterval, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var regime []exposureInterval
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(regime) == 0 && strings.TrimSpace(fields[0]) == "duration_s" {
+			continue
+		}
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("%s: line %d: expected 6 fields (%s), got %d",
+				filename, line, exposureRegimeColumns, len(fields))
+		}
+		values := make([]float64, len(fields))
+		for i, f := range fields {
+			v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("%s: line %d: field %d (%q) is not a number", filename, line, i+1, f)
+			}
+			values[i] = v
+		}
+		in := exposureInterval{Line: line, Duration: values[0], Irradiance: values[1],
+			BandFrom: values[2], BandTo: values[3], Shielding: values[4], Tapetal: values[5]}
+		switch {
+		case in.Duration <= 0:
+			return nil, fmt.Errorf("%s: line %d: duration must be positive, got %g", filename, line, in.Duration)
+		case in.Irradiance < 0:
+			return nil, fmt.Errorf("%s: line %d: irradiance must not be negative, got %g", filename, line, in.Irradiance)
+		case in.BandFrom <= 0 || in.BandTo < in.BandFrom:
+			return nil, fmt.Errorf("%s: line %d: band %g-%g nm is not a range of positive wavelengths",
+				filename, line, in.BandFrom, in.BandTo)
+		case in.Shielding < 0 || in.Shielding > 1 || in.Tapetal < 0 || in.Tapetal > 1:
+			return nil, fmt.Errorf("%s: line %d: pigment positions must be fractions from 0 to 1, got %g and %g",
+				filename, line, in.Shielding, in.Tapetal)
+		}
+		regime = append(regime, in)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filename, err)
+	}
+	if len(regime) == 0 {
+		return nil, fmt.Errorf("no exposure intervals found in %s", filename)
+	}
+	return regime, nil
+}
+
+// photonIrradiance converts an irradiance in W/m² to photons/m²/s, taking every photon
+// to have the wavelength at the middle of the band. The model's absorption does not
+// depend on wavelength, so the band only sets the energy of a photon.
+func photonIrradiance(irradiance, bandFrom, bandTo float64) float64 {
+	wavelength := (bandFrom + bandTo) / 2.0 * 1e-9
+	return irradiance * wavelength / (planckConstant * speedOfLight)
+}
+
+// absorbedPhotonDensity returns the rate at which one rhabdom absorbs photons in each
+// depth bin of a pigment state, per cubic micrometre of rhabdom, under a photon
+// irradiance in photons/m²/s. The aperture focuses the light it gathers onto a
+// rhabdom, and the blur spreads as much of its neighbours' light onto it as it
+// spreads away, so the rhabdom absorbs, at each depth, the share of the light falling
+// on the aperture that the depth profile gives.
+func (m *Model) absorbedPhotonDensity(depth []float64, photons float64) []float64 {
+	apertureArea := m.apertureArea()
+	crossSection := math.Pi * m.RhabdomRadius * m.RhabdomRadius // µm²
+	rates := make([]float64, len(depth))
+	for b, v := range depth {
+		from, to := m.depthBinEdges(b)
+		rates[b] = photons * apertureArea * v / 100.0 / (crossSection * (to - from))
+	}
+	return rates
+}
+
+// thresholdCrossing is when the dose in a depth bin first reached a damage threshold.
+type thresholdCrossing struct {
+	Threshold float64
+	// Time is in seconds from the start of the regime, or NaN if the threshold was
+	// never reached.
+	Time     float64
+	Interval int
+	Bin      int
+}
+
+// exposureDose steps through an exposure regime and writes the rate and cumulative
+// dose in each depth bin at the end of each interval to filename. It returns the first
+// crossing of each threshold and the cumulative dose in each bin at the end.
+func (m *Model) exposureDose(regime []exposureInterval, thresholds []float64, filename string) ([]thresholdCrossing, []float64, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+	fmt.Fprintln(writer, damageHeader)
+
+	crossings := make([]thresholdCrossing, len(thresholds))
+	for i, t := range thresholds {
+		crossings[i] = thresholdCrossing{Threshold: t, Time: math.NaN()}
+	}
+	// Regimes often return to the same pigment state, which need only be traced once.
+	states := map[[2]float64]blockSummary{}
+	dose := make([]float64, m.depthBins())
+	start := 0.0
+
+	for i, in := range regime {
+		key := [2]float64{in.Shielding, in.Tapetal}
+		state, ok := states[key]
+		if !ok {
+			length := m.Params.RhabdomLength
+			state = m.simulateState(-1, in.Shielding*length, in.Tapetal*length, nil)
+			states[key] = state
+		}
+		rates := m.absorbedPhotonDensity(state.Depth, photonIrradiance(in.Irradiance, in.BandFrom, in.BandTo))
+
+		// The rates hold steady through the interval, so the first bin to reach each
+		// threshold not yet crossed is the one with the least time to go.
+		for c := range crossings {
+			if !math.IsNaN(crossings[c].Time) {
+				continue
+			}
+			for b, rate := range rates {
+				if rate <= 0 {
+					continue
+				}
+				t := math.Max((crossings[c].Threshold-dose[b])/rate, 0)
+				if t <= in.Duration && (math.IsNaN(crossings[c].Time) || start+t < crossings[c].Time) {
+					crossings[c].Time, crossings[c].Interval, crossings[c].Bin = start+t, i, b
+				}
+			}
+		}
+		for b, rate := range rates {
+			dose[b] += rate * in.Duration
+		}
+
+		for b, rate := range rates {
+			from, to := m.depthBinEdges(b)
+			exceeded := 0
+			for _, t := range thresholds {
+				if dose[b] >= t {
+					exceeded++
+				}
+			}
+			if _, err := fmt.Fprintf(writer, "%d,%.4f,%.4f,%.4f,%.4f,%g,%g,%g,%.4f,%.4f,%.6g,%.6g,%d\n",
+				i, start, start+in.Duration, in.Shielding, in.Tapetal, in.Irradiance, in.BandFrom, in.BandTo,
+				from, to, rate, dose[b], exceeded); err != nil {
+				return nil, nil, fmt.Errorf("writing %s: %w", filename, err)
+			}
+		}
+		start += in.Duration
+	}
+	return crossings, dose, writer.Flush()
+}
+
+// parseThresholds parses a comma-separated list of positive damage thresholds.
+func parseThresholds(spec string) ([]float64, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	var out []float64
+	for _, f := range strings.Split(spec, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || !(v > 0) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("threshold %q is not a positive number", f)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
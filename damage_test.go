@@ -0,0 +1,94 @@
+// FILE: damage_test.go
+// This file contains tests for the photic damage model in damage.go
+
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadExposureRegime(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		t.Helper()
+		name := filepath.Join(dir, "regime.csv")
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+
+	regime, err := readExposureRegime(write(exposureRegimeColumns + "\n# comment\n\n60,1.5,400,700,0.25,0\n"))
+	if err != nil {
+		t.Fatalf("readExposureRegime returned an unexpected error: %v", err)
+	}
+	want := exposureInterval{Line: 4, Duration: 60, Irradiance: 1.5, BandFrom: 400, BandTo: 700, Shielding: 0.25}
+	if len(regime) != 1 || regime[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, regime)
+	}
+
+	for _, bad := range []string{
+		"60,1,400,700,0\n",
+		"0,1,400,700,0,0\n",
+		"60,-1,400,700,0,0\n",
+		"60,1,700,400,0,0\n",
+		"60,1,400,700,1.5,0\n",
+		"60,x,400,700,0,0\n",
+		"# nothing\n",
+	} {
+		if _, err := readExposureRegime(write(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestPhotonIrradiance(t *testing.T) {
+	// One watt of 500 nm light is about 2.517e18 photons a second.
+	if got := photonIrradiance(1, 450, 550); math.Abs(got-2.5170e18)/2.5170e18 > 1e-4 {
+		t.Errorf("Expected about 2.517e18 photons/m²/s, got %g", got)
+	}
+}
+
+// TestExposureDose checks that the dose accumulates linearly through the regime, and
+// that a threshold is crossed where the rate says it should be.
+func TestExposureDose(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_damage"))
+	regime := []exposureInterval{
+		{Line: 1, Duration: 100, Irradiance: 1e-4, BandFrom: 500, BandTo: 500},
+		{Line: 2, Duration: 50, Irradiance: 0, BandFrom: 500, BandTo: 500, Shielding: 1, Tapetal: 1},
+		{Line: 3, Duration: 100, Irradiance: 1e-4, BandFrom: 500, BandTo: 500},
+	}
+	rates := model.absorbedPhotonDensity(model.simulateState(0, 0, 0, nil).Depth, photonIrradiance(1e-4, 500, 500))
+	threshold := rates[0] * 150
+	filename := filepath.Join(t.TempDir(), "damage.csv")
+
+	crossings, dose, err := model.exposureDose(regime, []float64{threshold, rates[0] * 1000}, filename)
+	if err != nil {
+		t.Fatalf("exposureDose returned an unexpected error: %v", err)
+	}
+	for b, rate := range rates {
+		if math.Abs(dose[b]-rate*200) > 1e-9*rate*200 {
+			t.Errorf("Bin %d: expected a dose of %g, got %g", b, rate*200, dose[b])
+		}
+	}
+	// The dark interval adds nothing, so the threshold is reached 50 s into the third.
+	if c := crossings[0]; c.Interval != 2 || c.Bin != 0 || math.Abs(c.Time-200) > 1e-9 {
+		t.Errorf("Expected the threshold crossed at the distal tip after 200 s, got %+v", c)
+	}
+	if !math.IsNaN(crossings[1].Time) {
+		t.Errorf("Expected the higher threshold not to be reached, got %+v", crossings[1])
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if want := 1 + len(regime)*model.depthBins(); len(lines) != want {
+		t.Errorf("Expected %d lines, got %d", want, len(lines))
+	}
+}
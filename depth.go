@@ -0,0 +1,133 @@
+// FILE: depth.go
+// This file contains the axial absorption profile, which divides the light absorbed
+// in each pigment state by depth along the rhabdom to show which part of it is most
+// exposed.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+)
+
+// defaultDepthBin is the width of the depth bins, in micrometres, unless the run asks
+// for another.
+const defaultDepthBin = 10.0
+
+// depthProfileHeader labels the columns of {species}_depth.csv.
+const depthProfileHeader = "block,shielding_step,tapetal_step,depth_from_um,depth_to_um,absorbed_pct,absorbed_pct_per_um"
+
+// depthBins is the number of bins from the distal tip to the base of the rhabdom. The
+// last is narrower when the bin width does not divide the rhabdom length.
+func (m *Model) depthBins() int {
+	return int(math.Ceil(m.Params.RhabdomLength/m.DepthBin - 1e-9))
+}
+
+// depthBinEdges returns the depths from the distal tip, in micrometres, at which a bin
+// starts and ends.
+func (m *Model) depthBinEdges(bin int) (from, to float64) {
+	from = float64(bin) * m.DepthBin
+	to = math.Min(from+m.DepthBin, m.Params.RhabdomLength)
+	return from, to
+}
+
+// addToDepthProfile adds the light one facet's ray absorbs into the depth profile, as
+// a percentage of the light incident on the eyeshine patch. The light decays along
+// the ray's legs as it does along its path lengths, one rhabdom after another, and
+// each leg's share is divided between the depth bins it crosses in proportion to the
+// light absorbed over each part of it.
+func (m *Model) addToDepthProfile(profile []float64, facetIndex int, trace traceResult) {
+	carried := 100.0 * ringArea(facetIndex) / m.patchArea() * m.facetTransmission(facetIndex)
+	last := len(profile) - 1
+	bin := func(depth float64) int {
+		return min(max(int(depth/m.DepthBin), 0), last)
+	}
+
+	for _, seg := range trace.Segments {
+		if seg.Length <= 0 {
+			continue
+		}
+		lo, hi := math.Min(seg.StartDepth, seg.EndDepth), math.Max(seg.StartDepth, seg.EndDepth)
+		if hi == lo {
+			profile[bin(lo)] += carried * (1.0 - math.Exp(-absorptionCoefficient*seg.Length))
+		} else {
+			// Path travelled along the leg when it reaches a depth.
+			along := func(depth float64) float64 {
+				return seg.Length * math.Abs(depth-seg.StartDepth) / (hi - lo)
+			}
+			for b := bin(lo); b <= bin(hi); b++ {
+				from, to := m.depthBinEdges(b)
+				p0, p1 := along(math.Max(from, lo)), along(math.Min(to, hi))
+				if p0 > p1 {
+					p0, p1 = p1, p0
+				}
+				profile[b] += carried * (math.Exp(-absorptionCoefficient*p0) - math.Exp(-absorptionCoefficient*p1))
+			}
+		}
+		carried *= math.Exp(-absorptionCoefficient * seg.Length)
+	}
+}
+
+// peakDose returns the depth bin of a profile that absorbs the most light per
+// micrometre of depth, and that amount as a percentage of the incident light.
+func (m *Model) peakDose(profile []float64) (bin int, perMicrometre float64) {
+	for b, v := range profile {
+		from, to := m.depthBinEdges(b)
+		if d := v / (to - from); d > perMicrometre {
+			bin, perMicrometre = b, d
+		}
+	}
+	return bin, perMicrometre
+}
+
+// writeDepthProfile writes {species}_depth.csv, the light each pigment state absorbs
+// in each bin of depth from the distal tip, and {species}_depth_peak.csv, the matrix
+// of the most light any bin of each state absorbs per micrometre of depth. It returns
+// the names of the files.
+func (m *Model) writeDepthProfile(summaries []blockSummary) ([]string, error) {
+	filename := fmt.Sprintf("%s_depth.csv", m.Params.SpeciesName)
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, depthProfileHeader)
+	for block, s := range summaries {
+		for b, v := range s.Depth {
+			from, to := m.depthBinEdges(b)
+			if _, err := fmt.Fprintf(writer, "%d,%d,%d,%.4f,%.4f,%.6f,%.6f\n", block, block/pigmentSteps,
+				block%pigmentSteps, from, to, v, v/(to-from)); err != nil {
+				return []string{filename}, fmt.Errorf("writing %s: %w", filename, err)
+			}
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return []string{filename}, fmt.Errorf("writing %s: %w", filename, err)
+	}
+
+	peakFile := fmt.Sprintf("%s_depth_peak.csv", m.Params.SpeciesName)
+	return []string{filename, peakFile}, writeSummaryMatrix(peakFile, summaries,
+		func(s blockSummary) float64 {
+			_, d := m.peakDose(s.Depth)
+			return d
+		})
+}
+
+// printPeakDose prints the most light absorbed per micrometre of depth by any pigment
+// state, and where.
+func (m *Model) printPeakDose(summaries []blockSummary) {
+	block, bin, dose := 0, 0, 0.0
+	for i, s := range summaries {
+		if b, d := m.peakDose(s.Depth); d > dose {
+			block, bin, dose = i, b, d
+		}
+	}
+	from, to := m.depthBinEdges(bin)
+	fmt.Printf("Peak absorbed dose %.4f%% of the incident light per um, %g-%g um from the distal tip, at block %d\n",
+		dose, from, to, block)
+}
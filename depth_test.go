@@ -0,0 +1,54 @@
+// FILE: depth_test.go
+// This file contains tests for the axial absorption profile in depth.go
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestDepthProfileAccountsForAbsorption checks that dividing the absorbed light by
+// depth neither loses nor invents any, whatever the bin width.
+func TestDepthProfileAccountsForAbsorption(t *testing.T) {
+	for _, width := range []float64{10, 7, 180, 1000} {
+		model := mustModel(t, nephropsFlatLateral("test_depth"))
+		model.DepthBin = width
+		for block, s := range model.simulate(nil) {
+			if want := int(math.Ceil(180 / math.Min(width, 180))); len(s.Depth) != want {
+				t.Fatalf("Bin width %g: expected %d bins, got %d", width, want, len(s.Depth))
+			}
+			total := 0.0
+			for _, v := range s.Depth {
+				total += v
+			}
+			if math.Abs(total-s.SensitivityPercent) > 1e-9 {
+				t.Errorf("Bin width %g, block %d: depth profile sums to %f%%, sensitivity %f%%",
+					width, block, total, s.SensitivityPercent)
+			}
+		}
+	}
+}
+
+// TestDepthProfileShape checks that light absorbed on the way in falls off with depth,
+// and that the last bin is measured by its own, narrower, width.
+func TestDepthProfileShape(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_depth"))
+	model.DepthBin = 40
+	summaries := model.simulate(nil)
+
+	// Dark-adapted, with no tapetum, light is only absorbed on the way in.
+	dark := summaries[0].Depth
+	for b := 1; b < len(dark)-1; b++ {
+		if dark[b] >= dark[b-1] {
+			t.Errorf("Expected absorption to fall with depth, bin %d has %f after %f", b, dark[b], dark[b-1])
+		}
+	}
+	if from, to := model.depthBinEdges(len(dark) - 1); from != 160 || to != 180 {
+		t.Errorf("Expected the last bin to span 160-180 um, got %g-%g", from, to)
+	}
+	bin, dose := model.peakDose(dark)
+	if bin != 0 || math.Abs(dose-dark[0]/40) > 1e-12 {
+		t.Errorf("Expected the peak dose at the distal tip, %f per um, got bin %d with %f", dark[0]/40, bin, dose)
+	}
+}
@@ -0,0 +1,86 @@
+// FILE: detect.go
+// This file contains the point-source detection model, which works out how far away
+// each pigment state can see a bioluminescent flash.
+
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// flash is a bioluminescent point source seen through water, and what it takes to see
+// it.
+type flash struct {
+	// Photons is the number the source emits per second, evenly in every direction.
+	Photons float64
+	// Attenuation is the beam attenuation coefficient of the water, per metre.
+	Attenuation float64
+	// Threshold is the number of photons one rhabdom must absorb within Integration
+	// seconds for the flash to be seen.
+	Threshold   float64
+	Integration float64
+}
+
+// pointCatchFraction returns the share of the light entering the aperture from a point
+// source on the optic axis that the brightest single rhabdom absorbs. The PSF gives the
+// light per rhabdom, in the same units as the sensitivity, which is a percentage of the
+// light incident on the eyeshine patch.
+func (m *Model) pointCatchFraction(s blockSummary) float64 {
+	if len(s.PSF) == 0 {
+		return 0
+	}
+	return s.PSF[s.PeakOffset] / m.patchArea() / 100.0
+}
+
+// detectionRange returns the greatest distance, in metres, at which the brightest
+// rhabdom of a pigment state absorbs the flash's threshold. At a distance r the
+// photons it absorbs are K exp(-c r) / r², for c the attenuation and K everything
+// else, and setting that to the threshold T gives r = (2/c) W((c/2) sqrt(K/T)), for W
+// the Lambert W function.
+func (m *Model) detectionRange(s blockSummary, f flash) float64 {
+	k := f.Photons / (4.0 * math.Pi) * m.apertureArea() * m.pointCatchFraction(s) * f.Integration
+	if k <= 0 {
+		return 0
+	}
+	reach := math.Sqrt(k / f.Threshold)
+	if f.Attenuation == 0 {
+		return reach
+	}
+	return 2.0 / f.Attenuation * lambertW(f.Attenuation/2.0*reach)
+}
+
+// lambertW returns the principal branch of the Lambert W function, the w for which
+// w exp(w) = x, for x >= 0.
+func lambertW(x float64) float64 {
+	if x == 0 {
+		return 0
+	}
+	// Start from log(1+x), which is close enough everywhere for Halley's method to
+	// converge in a few steps.
+	w := math.Log1p(x)
+	for i := 0; i < 50; i++ {
+		e := math.Exp(w)
+		f := w*e - x
+		step := f / (e*(w+1) - (w+2)*f/(2*w+2))
+		w -= step
+		if math.Abs(step) <= 1e-15*math.Max(1, math.Abs(w)) {
+			break
+		}
+	}
+	return w
+}
+
+// printDetectionRange prints the detection range of the dark- and light-adapted states
+// and of the state that sees furthest.
+func printDetectionRange(ranges []float64) {
+	furthest := 0
+	for block, r := range ranges {
+		if r > ranges[furthest] {
+			furthest = block
+		}
+	}
+	fmt.Printf("Detection range: dark-adapted %.2f m, light-adapted %.2f m, furthest %.2f m at block %d "+
+		"(shielding step %d, tapetal step %d)\n", ranges[0], ranges[len(ranges)-1], ranges[furthest],
+		furthest, furthest/pigmentSteps, furthest%pigmentSteps)
+}
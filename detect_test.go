@@ -0,0 +1,49 @@
+// FILE: detect_test.go
+// This file contains tests for the point-source detection model in detect.go
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLambertW(t *testing.T) {
+	for _, x := range []float64{0, 1e-9, 0.5, 1, math.E, 100, 1e12} {
+		w := lambertW(x)
+		if got := w * math.Exp(w); math.Abs(got-x) > 1e-12*math.Max(1, x) {
+			t.Errorf("W(%g) = %g, but W exp(W) = %g", x, w, got)
+		}
+	}
+}
+
+// TestDetectionRange checks that the brightest rhabdom absorbs exactly the threshold
+// at the detection range, and that the peak share agrees with the sensitivity.
+func TestDetectionRange(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_detect"))
+	s := model.simulateState(0, 0, 0, nil)
+
+	total := 0.0
+	for j, v := range s.PSF {
+		total += v * ringArea(j)
+	}
+	if got := total / model.patchArea(); math.Abs(got-s.SensitivityPercent) > 1e-9 {
+		t.Errorf("Expected the PSF to add up to the sensitivity %g, got %g", s.SensitivityPercent, got)
+	}
+
+	for _, f := range []flash{
+		{Photons: 1e10, Attenuation: 0.05, Threshold: 5, Integration: 0.1},
+		{Photons: 1e12, Attenuation: 0, Threshold: 1, Integration: 0.2},
+	} {
+		r := model.detectionRange(s, f)
+		caught := f.Photons / (4 * math.Pi) * math.Exp(-f.Attenuation*r) / (r * r) *
+			model.apertureArea() * model.pointCatchFraction(s) * f.Integration
+		if !(r > 0) || math.Abs(caught-f.Threshold) > 1e-9*f.Threshold {
+			t.Errorf("%+v: at %g m the brightest rhabdom absorbs %g photons, expected %g", f, r, caught, f.Threshold)
+		}
+	}
+
+	if r := model.detectionRange(blockSummary{}, flash{Photons: 1e10, Threshold: 1, Integration: 1}); r != 0 {
+		t.Errorf("Expected a state that absorbs nothing to see nothing, got %g m", r)
+	}
+}
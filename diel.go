@@ -0,0 +1,241 @@
+// FILE: diel.go
+// This file contains the diel cycle simulation, which follows the pigments as they
+// migrate after the changing light of a day and reports how resolution, sensitivity
+// and the photons each rhabdom absorbs change over it.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lightCurveColumns is the layout of a light curve file, as its header.
+const lightCurveColumns = "time_h,irradiance_w_m2"
+
+// dielHeader labels the columns of {species}_diel.csv.
+const dielHeader = "time_h,irradiance_w_m2,log_irradiance,target_shielding_fraction,target_tapetal_fraction," +
+	"shielding_fraction,tapetal_fraction,fwhm_deg,sensitivity_pct,absorbed_photons_per_s"
+
+// lightCurve gives the irradiance falling on the eye, in W/m², at a time of day in
+// hours from midnight.
+type lightCurve func(hours float64) float64
+
+// daylight is sunlight that rises and falls as the sine of the time between sunrise
+// and sunset, attenuated exponentially with depth, over a constant night-time floor of
+// moon and starlight.
+type daylight struct {
+	// Surface is the irradiance at the surface at noon, in W/m².
+	Surface float64
+	// Depth is in metres, and Attenuation is the diffuse attenuation coefficient of the
+	// water, per metre.
+	Depth, Attenuation float64
+	// Sunrise and Sunset are in hours from midnight.
+	Sunrise, Sunset float64
+	// Night is the irradiance at depth when the sun is down, in W/m².
+	Night float64
+}
+
+// at returns the irradiance at depth at a time of day.
+func (d daylight) at(hours float64) float64 {
+	h := math.Mod(hours, 24)
+	sun := 0.0
+	if h > d.Sunrise && h < d.Sunset {
+		sun = d.Surface * math.Sin(math.Pi*(h-d.Sunrise)/(d.Sunset-d.Sunrise))
+	}
+	return sun*math.Exp(-d.Attenuation*d.Depth) + d.Night
+}
+
+// lightSample is one point of a light curve read from a file.
+type lightSample struct {
+	Hours, Irradiance float64
+}
+
+// readLightCurve parses a light curve file: one time in hours and irradiance in W/m²
+// per line, with an optional header. Blank lines and lines starting with # are
+// ignored. The curve is interpolated linearly between the samples, which must be in
+// order of time, and holds its first and last values beyond them. The irradiances must
+// be positive, since the pigments are placed by their logarithm.
+func readLightCurve(filename string) (lightCurve, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var samples []lightSample
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(samples) == 0 && strings.TrimSpace(fields[0]) == "time_h" {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s: line %d: expected 2 fields (%s), got %d",
+				filename, line, lightCurveColumns, len(fields))
+		}
+		var v [2]float64
+		for i, f := range fields {
+			x, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+			if err != nil || math.IsNaN(x) || math.IsInf(x, 0) {
+				return nil, fmt.Errorf("%s: line %d: field %d (%q) is not a number", filename, line, i+1, f)
+			}
+			v[i] = x
+		}
+		s := lightSample{Hours: v[0], Irradiance: v[1]}
+		switch {
+		case !(s.Irradiance > 0):
+			return nil, fmt.Errorf("%s: line %d: irradiance must be positive, got %g", filename, line, s.Irradiance)
+		case len(samples) > 0 && s.Hours <= samples[len(samples)-1].Hours:
+			return nil, fmt.Errorf("%s: line %d: time %g h is not after the line before", filename, line, s.Hours)
+		}
+		samples = append(samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filename, err)
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no light samples found in %s", filename)
+	}
+
+	return func(hours float64) float64 {
+		i := sort.Search(len(samples), func(i int) bool { return samples[i].Hours >= hours })
+		switch {
+		case i == 0:
+			return samples[0].Irradiance
+		case i == len(samples):
+			return samples[len(samples)-1].Irradiance
+		}
+		a, b := samples[i-1], samples[i]
+		return a.Irradiance + (b.Irradiance-a.Irradiance)*(hours-a.Hours)/(b.Hours-a.Hours)
+	}, nil
+}
+
+// migration is how quickly a pigment follows the light, as the time constants of a
+// first-order approach to the position the light-adaptation model gives, in minutes.
+// Pigments usually advance into the light faster than they withdraw in the dark.
+type migration struct {
+	Light, Dark float64
+}
+
+// defaultShieldingMigration and defaultTapetalMigration are placeholders of the order
+// measured in decapod eyes, where the pigments take tens of minutes to light-adapt and
+// an hour or more to dark-adapt. Give time constants measured for the eye in question.
+var (
+	defaultShieldingMigration = migration{Light: 15, Dark: 60}
+	defaultTapetalMigration   = migration{Light: 30, Dark: 90}
+)
+
+// parseMigration parses time constants given as "light,dark" in minutes.
+func parseMigration(spec string) (migration, error) {
+	fields := strings.Split(spec, ",")
+	if len(fields) != 2 {
+		return migration{}, fmt.Errorf("time constants %q: expected light,dark in minutes", spec)
+	}
+	var v [2]float64
+	for i, f := range fields {
+		x, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || !(x > 0) || math.IsInf(x, 0) {
+			return migration{}, fmt.Errorf("time constants %q: field %d (%q) is not a positive number", spec, i+1, f)
+		}
+		v[i] = x
+	}
+	return migration{Light: v[0], Dark: v[1]}, nil
+}
+
+// String formats the time constants as parseMigration expects them.
+func (g migration) String() string {
+	return fmt.Sprintf("%g,%g", g.Light, g.Dark)
+}
+
+// step moves a pigment position towards its target over minutes, which the target
+// holds still for. Moving towards bright-light positions uses the light time constant
+// and moving back the dark one.
+func (g migration) step(position, target, minutes float64) float64 {
+	tau := g.Dark
+	if target > position {
+		tau = g.Light
+	}
+	return target + (position-target)*math.Exp(-minutes/tau)
+}
+
+// dielStep is the state of the eye at one time of the cycle.
+type dielStep struct {
+	Hours      float64
+	Irradiance float64
+	// TargetShielding and TargetTapetal are the positions the light-adaptation model
+	// gives for the light at this time, and Shielding and Tapetal those the pigments
+	// have reached, all as fractions of the rhabdom length.
+	TargetShielding, TargetTapetal float64
+	Shielding, Tapetal             float64
+	FWHMDegrees                    float64
+	SensitivityPercent             float64
+	// AbsorbedPhotons is the rate at which one rhabdom absorbs photons.
+	AbsorbedPhotons float64
+}
+
+// dielCycle steps the pigments through hours of light, starting at midnight adapted to
+// the light there, and evaluates the eye after each step of stepMinutes. The light is
+// taken to hold still over each step, with photons of the wavelength at the middle of
+// the band. If grid is given the pigment states are interpolated from it rather than
+// simulated.
+func (m *Model) dielCycle(a lightAdaptation, shieldingRate, tapetalRate migration, light lightCurve,
+	hours, stepMinutes, bandFrom, bandTo float64, grid []blockSummary) []dielStep {
+	steps := int(math.Round(hours * 60 / stepMinutes))
+	out := make([]dielStep, 0, steps+1)
+	var shielding, tapetal float64
+
+	for i := 0; i <= steps; i++ {
+		h := float64(i) * stepMinutes / 60
+		irradiance := light(h)
+		targetShielding, targetTapetal := a.positions(math.Log10(irradiance))
+		if i == 0 {
+			shielding, tapetal = targetShielding, targetTapetal
+		} else {
+			shielding = shieldingRate.step(shielding, targetShielding, stepMinutes)
+			tapetal = tapetalRate.step(tapetal, targetTapetal, stepMinutes)
+		}
+		fwhm, sensitivity := m.pigmentResponse(grid, shielding, tapetal)
+		out = append(out, dielStep{
+			Hours: h, Irradiance: irradiance,
+			TargetShielding: targetShielding, TargetTapetal: targetTapetal,
+			Shielding: shielding, Tapetal: tapetal,
+			FWHMDegrees: fwhm, SensitivityPercent: sensitivity,
+			AbsorbedPhotons: photonIrradiance(irradiance, bandFrom, bandTo) * m.apertureArea() * sensitivity / 100.0,
+		})
+	}
+	return out
+}
+
+// writeDiel writes the steps of a diel cycle to filename.
+func writeDiel(filename string, steps []dielStep) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, dielHeader)
+	for _, s := range steps {
+		if _, err := fmt.Fprintf(writer, "%.4f,%.6g,%.4f,%.6f,%.6f,%.6f,%.6f,%s,%s,%.6g\n",
+			s.Hours, s.Irradiance, math.Log10(s.Irradiance), s.TargetShielding, s.TargetTapetal,
+			s.Shielding, s.Tapetal, strconv.FormatFloat(s.FWHMDegrees, 'f', 4, 64),
+			strconv.FormatFloat(s.SensitivityPercent, 'f', 4, 64), s.AbsorbedPhotons); err != nil {
+			return fmt.Errorf("writing %s: %w", filename, err)
+		}
+	}
+	return writer.Flush()
+}
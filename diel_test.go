@@ -0,0 +1,130 @@
+// FILE: diel_test.go
+// This file contains tests for the diel cycle simulation in diel.go
+
+package main
+
+import (
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDaylight(t *testing.T) {
+	d := daylight{Surface: 100, Depth: 10, Attenuation: 0.1, Sunrise: 6, Sunset: 18, Night: 1e-6}
+	if got, want := d.at(12), 100*math.Exp(-1)+1e-6; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Expected %g at noon, got %g", want, got)
+	}
+	for _, h := range []float64{0, 6, 18, 23.5} {
+		if got := d.at(h); got != 1e-6 {
+			t.Errorf("Expected the night-time floor at %g h, got %g", h, got)
+		}
+	}
+	if math.Abs(d.at(9)-d.at(15)) > 1e-12 || math.Abs(d.at(9)-d.at(33)) > 1e-12 {
+		t.Errorf("Expected the day to be symmetric about noon and to repeat")
+	}
+}
+
+func TestReadLightCurve(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		t.Helper()
+		name := filepath.Join(dir, "light.csv")
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+
+	light, err := readLightCurve(write(lightCurveColumns + "\n# comment\n\n6,1\n12,11\n18,1\n"))
+	if err != nil {
+		t.Fatalf("readLightCurve returned an unexpected error: %v", err)
+	}
+	for h, want := range map[float64]float64{0: 1, 6: 1, 9: 6, 12: 11, 16.5: 3.5, 24: 1} {
+		if got := light(h); math.Abs(got-want) > 1e-12 {
+			t.Errorf("At %g h: expected %g, got %g", h, want, got)
+		}
+	}
+
+	for _, bad := range []string{"6\n", "6,x\n", "6,-1\n", "6,0\n", "6,1\n6,2\n", "# nothing\n"} {
+		if _, err := readLightCurve(write(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestMigration(t *testing.T) {
+	g, err := parseMigration("10,40")
+	if err != nil || g != (migration{Light: 10, Dark: 40}) {
+		t.Fatalf("Expected 10,40 to parse, got %+v (%v)", g, err)
+	}
+	if got, want := g.step(0, 1, 10), 1-math.Exp(-1); math.Abs(got-want) > 1e-12 {
+		t.Errorf("Expected light adaptation to follow the light time constant, got %g, want %g", got, want)
+	}
+	if got, want := g.step(1, 0, 40), math.Exp(-1); math.Abs(got-want) > 1e-12 {
+		t.Errorf("Expected dark adaptation to follow the dark time constant, got %g, want %g", got, want)
+	}
+	for _, bad := range []string{"10", "10,0", "x,10", "10,-5"} {
+		if _, err := parseMigration(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+// TestDielCycle checks that the pigments lag behind a step in the light, and that the
+// photons absorbed agree with the damage model's absorption along the rhabdom.
+func TestDielCycle(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_diel"))
+	light := func(hours float64) float64 {
+		if hours < 1 {
+			return 1e-6
+		}
+		return 1e2
+	}
+	rate := migration{Light: 30, Dark: 30}
+	steps := model.dielCycle(defaultAdaptation, rate, rate, light, 3, 30, 500, 500, nil)
+	if len(steps) != 7 {
+		t.Fatalf("Expected 7 steps, got %d", len(steps))
+	}
+	if s := steps[0]; s.Shielding != s.TargetShielding || s.Tapetal != s.TargetTapetal {
+		t.Errorf("Expected the cycle to start adapted to the light, got %+v", s)
+	}
+	for i := 3; i < len(steps); i++ {
+		if !(steps[i].Shielding > steps[i-1].Shielding) || !(steps[i].Shielding < steps[i].TargetShielding) {
+			t.Errorf("Step %d: expected the screening pigment to approach its target, got %g then %g towards %g",
+				i, steps[i-1].Shielding, steps[i].Shielding, steps[i].TargetShielding)
+		}
+	}
+
+	last := steps[len(steps)-1]
+	length := model.Params.RhabdomLength
+	state := model.simulateState(-1, last.Shielding*length, last.Tapetal*length, nil)
+	want := 0.0
+	for b, r := range model.absorbedPhotonDensity(state.Depth, photonIrradiance(last.Irradiance, 500, 500)) {
+		from, to := model.depthBinEdges(b)
+		want += r * math.Pi * model.RhabdomRadius * model.RhabdomRadius * (to - from)
+	}
+	if math.Abs(last.AbsorbedPhotons-want) > 1e-9*want {
+		t.Errorf("Expected %g photons/s absorbed, got %g", want, last.AbsorbedPhotons)
+	}
+}
+
+// TestDielRejectsDarkness checks that a night with no light at all is refused rather
+// than written out with a log irradiance of -Inf.
+func TestDielRejectsDarkness(t *testing.T) {
+	paramFile, err := filepath.Abs("example_data/nephrops_parameters.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	err = dielCommand(flag.NewFlagSet("diel", flag.ContinueOnError),
+		[]string{"-f", paramFile, "-species", "nephropsfl", "-night", "0"})
+	if err == nil || !strings.Contains(err.Error(), "-night") {
+		t.Errorf("Expected -night 0 to be refused, got %v", err)
+	}
+	if _, err := os.Stat("nephropsfl_diel.csv"); !os.IsNotExist(err) {
+		t.Errorf("Expected no output, got %v", err)
+	}
+}
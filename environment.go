@@ -0,0 +1,214 @@
+// FILE: environment.go
+// This file contains the underwater light environment: the spectrum of downwelling
+// radiance at depth, and the photons each rhabdom absorbs from an extended scene of it.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// attenuationSpectrumColumns is the layout of an attenuation spectrum file, as its
+// header.
+const attenuationSpectrumColumns = "wavelength_nm,kd_per_m"
+
+// radianceHeader labels the columns of {species}_radiance.csv.
+const radianceHeader = "wavelength_nm,kd_per_m,radiance_w_m2_sr_nm,radiance_photons_m2_sr_s_nm"
+
+// attenuationSpectrum is the diffuse attenuation coefficient of downwelling light in a
+// water, per metre, sampled at increasing wavelengths in nanometres.
+type attenuationSpectrum struct {
+	Wavelengths []float64
+	Kd          []float64
+}
+
+// jerlovWavelengths are the wavelengths, in nanometres, of the Jerlov water types.
+var jerlovWavelengths = []float64{350, 375, 400, 425, 450, 475, 500, 525, 550, 575, 600, 625, 650, 675, 700}
+
+// jerlovWaterTypes are the diffuse attenuation coefficients of downwelling irradiance,
+// per metre, for the oceanic water types of Jerlov (1976), from the clearest ocean (I)
+// to turbid shelf water (III). Coastal waters vary too much to tabulate; give their
+// spectra as a file.
+var jerlovWaterTypes = map[string][]float64{
+	"I":   {0.062, 0.038, 0.028, 0.022, 0.019, 0.018, 0.027, 0.043, 0.063, 0.089, 0.235, 0.305, 0.360, 0.420, 0.560},
+	"IA":  {0.078, 0.052, 0.038, 0.030, 0.026, 0.025, 0.032, 0.048, 0.067, 0.094, 0.240, 0.310, 0.370, 0.430, 0.565},
+	"IB":  {0.106, 0.066, 0.051, 0.042, 0.036, 0.033, 0.042, 0.054, 0.072, 0.099, 0.245, 0.315, 0.375, 0.435, 0.570},
+	"II":  {0.160, 0.115, 0.096, 0.079, 0.067, 0.057, 0.070, 0.071, 0.088, 0.115, 0.260, 0.335, 0.400, 0.465, 0.592},
+	"III": {0.280, 0.210, 0.170, 0.140, 0.120, 0.100, 0.110, 0.110, 0.120, 0.160, 0.300, 0.370, 0.450, 0.510, 0.610},
+}
+
+// jerlovWater returns the attenuation spectrum of a Jerlov oceanic water type.
+func jerlovWater(name string) (attenuationSpectrum, error) {
+	kd, ok := jerlovWaterTypes[strings.ToUpper(name)]
+	if !ok {
+		names := make([]string, 0, len(jerlovWaterTypes))
+		for n := range jerlovWaterTypes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return attenuationSpectrum{}, fmt.Errorf("unknown Jerlov water type %q; choose one of %s", name, strings.Join(names, ", "))
+	}
+	return attenuationSpectrum{Wavelengths: jerlovWavelengths, Kd: kd}, nil
+}
+
+// readAttenuationSpectrum parses an attenuation spectrum file: one wavelength in
+// nanometres and diffuse attenuation coefficient per metre per line, in order of
+// wavelength, with an optional header. Blank lines and lines starting with # are
+// ignored.
+func readAttenuationSpectrum(filename string) (attenuationSpectrum, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return attenuationSpectrum{}, err
+	}
+	defer file.Close()
+
+	var spectrum attenuationSpectrum
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(spectrum.Wavelengths) == 0 && strings.TrimSpace(fields[0]) == "wavelength_nm" {
+			continue
+		}
+		if len(fields) != 2 {
+			return attenuationSpectrum{}, fmt.Errorf("%s: line %d: expected 2 fields (%s), got %d",
+				filename, line, attenuationSpectrumColumns, len(fields))
+		}
+		var v [2]float64
+		for i, f := range fields {
+			x, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+			if err != nil || math.IsNaN(x) || math.IsInf(x, 0) {
+				return attenuationSpectrum{}, fmt.Errorf("%s: line %d: field %d (%q) is not a number", filename, line, i+1, f)
+			}
+			v[i] = x
+		}
+		n := len(spectrum.Wavelengths)
+		switch {
+		case v[0] <= 0:
+			return attenuationSpectrum{}, fmt.Errorf("%s: line %d: wavelength must be positive, got %g", filename, line, v[0])
+		case n > 0 && v[0] <= spectrum.Wavelengths[n-1]:
+			return attenuationSpectrum{}, fmt.Errorf("%s: line %d: wavelength %g nm is not after the line before", filename, line, v[0])
+		case v[1] < 0:
+			return attenuationSpectrum{}, fmt.Errorf("%s: line %d: attenuation must not be negative, got %g", filename, line, v[1])
+		}
+		spectrum.Wavelengths = append(spectrum.Wavelengths, v[0])
+		spectrum.Kd = append(spectrum.Kd, v[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return attenuationSpectrum{}, fmt.Errorf("reading %s: %w", filename, err)
+	}
+	if len(spectrum.Wavelengths) == 0 {
+		return attenuationSpectrum{}, fmt.Errorf("no attenuation coefficients found in %s", filename)
+	}
+	return spectrum, nil
+}
+
+// at returns the attenuation coefficient at a wavelength, interpolated linearly between
+// the samples and held at the first and last beyond them.
+func (a attenuationSpectrum) at(wavelength float64) float64 {
+	i := sort.SearchFloat64s(a.Wavelengths, wavelength)
+	switch {
+	case i == 0:
+		return a.Kd[0]
+	case i == len(a.Wavelengths):
+		return a.Kd[len(a.Kd)-1]
+	}
+	w0, w1 := a.Wavelengths[i-1], a.Wavelengths[i]
+	return a.Kd[i-1] + (a.Kd[i]-a.Kd[i-1])*(wavelength-w0)/(w1-w0)
+}
+
+// lightEnvironment is downwelling light at a depth in a water: radiance flat across a
+// band of wavelengths at the surface, attenuated with depth by the water's spectrum.
+type lightEnvironment struct {
+	Water attenuationSpectrum
+	// Depth is in metres.
+	Depth float64
+	// Surface is the downwelling radiance just below the surface, in W/m²/sr/nm.
+	Surface float64
+	// BandFrom and BandTo are the limits of the band, in nanometres.
+	BandFrom, BandTo float64
+}
+
+// spectralStep is the width, in nanometres, of the steps the band is integrated in.
+const spectralStep = 1.0
+
+// wavelengths returns the middle of each step across the band.
+func (e lightEnvironment) wavelengths() []float64 {
+	n := max(int(math.Ceil((e.BandTo-e.BandFrom)/spectralStep-1e-9)), 1)
+	width := (e.BandTo - e.BandFrom) / float64(n)
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = e.BandFrom + (float64(i)+0.5)*width
+	}
+	return out
+}
+
+// radianceAt returns the downwelling radiance at depth at a wavelength, in W/m²/sr/nm.
+func (e lightEnvironment) radianceAt(wavelength float64) float64 {
+	return e.Surface * math.Exp(-e.Water.at(wavelength)*e.Depth)
+}
+
+// photonRadiance returns the downwelling radiance at depth summed across the band, in
+// photons/m²/sr/s.
+func (e lightEnvironment) photonRadiance() float64 {
+	wavelengths := e.wavelengths()
+	width := (e.BandTo - e.BandFrom) / float64(len(wavelengths))
+	total := 0.0
+	for _, w := range wavelengths {
+		total += photonIrradiance(e.radianceAt(w), w, w) * width
+	}
+	return total
+}
+
+// extendedCatch returns the photons one rhabdom absorbs per second when the eye views
+// a uniform extended scene of a photon radiance in photons/m²/sr/s. Each direction the
+// eye views, one ommatidial angle square, delivers light through the aperture that the
+// pigment state absorbs in the rhabdoms around it, and each rhabdom takes in from its
+// neighbours' directions what its own spreads to them, so it absorbs the sensitivity's
+// share of one direction's light.
+func (m *Model) extendedCatch(sensitivity, photonRadiance float64) float64 {
+	solidAngle := math.Pow(m.OmmatidialAngle/radToDegConv, 2)
+	return photonRadiance * solidAngle * m.apertureArea() * sensitivity / 100.0
+}
+
+// catchMatrix returns the photons each pigment state absorbs per rhabdom per second
+// from an extended scene of a photon radiance in photons/m²/sr/s.
+func catchMatrix(m *Model, summaries []blockSummary, photonRadiance float64) []float64 {
+	values := make([]float64, len(summaries))
+	for i, s := range summaries {
+		values[i] = m.extendedCatch(s.SensitivityPercent, photonRadiance)
+	}
+	return values
+}
+
+// writeRadiance writes the spectrum of downwelling radiance at depth to filename.
+func (e lightEnvironment) writeRadiance(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, radianceHeader)
+	for _, w := range e.wavelengths() {
+		radiance := e.radianceAt(w)
+		if _, err := fmt.Fprintf(writer, "%g,%.4f,%.6g,%.6g\n", w, e.Water.at(w), radiance,
+			photonIrradiance(radiance, w, w)); err != nil {
+			return fmt.Errorf("writing %s: %w", filename, err)
+		}
+	}
+	return writer.Flush()
+}
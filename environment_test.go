@@ -0,0 +1,103 @@
+// FILE: environment_test.go
+// This file contains tests for the underwater light environment in environment.go
+
+package main
+
+import (
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJerlovWater(t *testing.T) {
+	water, err := jerlovWater("ib")
+	if err != nil {
+		t.Fatalf("jerlovWater returned an unexpected error: %v", err)
+	}
+	if got := water.at(475); got != 0.033 {
+		t.Errorf("Expected 0.033 per m at 475 nm, got %g", got)
+	}
+	if got := water.at(487.5); math.Abs(got-0.0375) > 1e-12 {
+		t.Errorf("Expected 0.0375 per m between samples, got %g", got)
+	}
+	if water.at(300) != 0.106 || water.at(800) != 0.570 {
+		t.Errorf("Expected the ends of the spectrum to hold beyond it")
+	}
+	if _, err := jerlovWater("coastal"); err == nil {
+		t.Errorf("Expected an error for an unknown water type")
+	}
+}
+
+func TestReadAttenuationSpectrum(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		t.Helper()
+		name := filepath.Join(dir, "kd.csv")
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+
+	water, err := readAttenuationSpectrum(write(attenuationSpectrumColumns + "\n# comment\n\n400,0.2\n600,0.4\n"))
+	if err != nil {
+		t.Fatalf("readAttenuationSpectrum returned an unexpected error: %v", err)
+	}
+	if got := water.at(500); math.Abs(got-0.3) > 1e-12 {
+		t.Errorf("Expected 0.3 per m at 500 nm, got %g", got)
+	}
+
+	for _, bad := range []string{"400\n", "400,x\n", "0,0.1\n", "400,-0.1\n", "500,0.1\n400,0.1\n", "# nothing\n"} {
+		if _, err := readAttenuationSpectrum(write(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+// TestPhotonRadiance checks the band integral against its closed form, and that the
+// light falls off with depth as the attenuation says.
+func TestPhotonRadiance(t *testing.T) {
+	env := lightEnvironment{
+		Water:   attenuationSpectrum{Wavelengths: []float64{500}, Kd: []float64{0.05}},
+		Surface: 0.1, BandFrom: 400, BandTo: 700,
+	}
+	// A flat energy spectrum carries photons in proportion to wavelength.
+	want := 0.1 * (700*700 - 400*400) / 2 * 1e-9 / (planckConstant * speedOfLight)
+	if got := env.photonRadiance(); math.Abs(got-want) > 1e-9*want {
+		t.Errorf("Expected %g photons/m²/sr/s at the surface, got %g", want, got)
+	}
+	env.Depth = 100
+	if got := env.photonRadiance(); math.Abs(got-want*math.Exp(-5)) > 1e-9*want {
+		t.Errorf("Expected %g photons/m²/sr/s at 100 m, got %g", want*math.Exp(-5), got)
+	}
+}
+
+func TestExtendedCatch(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_catch"))
+	solidAngle := math.Pow(model.OmmatidialAngle*math.Pi/180, 2)
+	want := 1e15 * solidAngle * model.apertureArea() * 0.5
+	if got := model.extendedCatch(50, 1e15); math.Abs(got-want) > 1e-9*want {
+		t.Errorf("Expected %g photons/s, got %g", want, got)
+	}
+}
+
+// TestLightEnvironmentRejectsEmptyBand checks that a band with no width is refused,
+// since a radiance per nanometre across it would deliver no photons at all.
+func TestLightEnvironmentRejectsEmptyBand(t *testing.T) {
+	for _, args := range [][]string{
+		{"-band-from", "500", "-band-to", "500"},
+		{"-band-from", "600", "-band-to", "500"},
+	} {
+		fs := flag.NewFlagSet("catch", flag.ContinueOnError)
+		environment := lightEnvironmentFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := environment(); err == nil || !strings.Contains(err.Error(), "band") {
+			t.Errorf("%v: expected the band to be refused, got %v", args, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// FILE: eyeshine.go
+// This file contains the eyeshine prediction: the light the tapetum returns out
+// through the aperture, for comparison with ophthalmoscope measurements.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+)
+
+// eyeshineAngularHeader labels the columns of {species}_eyeshine_angular.csv.
+const eyeshineAngularHeader = "block,shielding_step,tapetal_step,offset_rhabdoms,angle_deg,reflected_pct,relative_intensity"
+
+// eyeshine is the light one pigment state returns out of the eye and how it is spread
+// across angle.
+type eyeshine struct {
+	// Percent is the percentage of the incident light returned, as in the energy budget.
+	Percent float64
+	// Intensity is the returned light per unit area at each rhabdom offset from the
+	// optic axis, relative to its peak, in the layout of blockSummary.PSF. It is empty
+	// when no light is returned.
+	Intensity []float64
+	// FWHMDegrees is the full width at half maximum of the returned light, or NaN when
+	// it is annular or there is none.
+	FWHMDegrees float64
+}
+
+// eyeshine describes the light a pigment state returns out of the eye. Light the
+// tapetum returns at an offset of j rhabdoms leaves along the direction that offset
+// views, j ommatidial angles from the optic axis, so its spread is summarised exactly
+// as the absorbed light is.
+func (m *Model) eyeshine(s blockSummary) eyeshine {
+	profile := make([]float64, len(s.Budget.ReflectedAt))
+	for j, v := range s.Budget.ReflectedAt {
+		// Back to the area-weighted units summariseBlock expects.
+		profile[j] = v * m.patchArea() / 100.0
+	}
+	summary := m.summariseBlock(profile)
+	out := eyeshine{Percent: s.Budget.Reflected, FWHMDegrees: summary.FWHMDegrees}
+	if len(summary.PSF) > 0 {
+		peak := summary.PSF[summary.PeakOffset]
+		out.Intensity = make([]float64, len(summary.PSF))
+		for j, v := range summary.PSF {
+			out.Intensity[j] = v / peak
+		}
+	}
+	return out
+}
+
+// writeEyeshine writes {species}_eyeshine.csv, the matrix of the percentage of the
+// incident light each pigment state returns out of the eye, and
+// {species}_eyeshine_angular.csv, its distribution across angle. States that return
+// no light have no rows in the angular distribution. It returns the names of the
+// files.
+func (m *Model) writeEyeshine(summaries []blockSummary) ([]string, error) {
+	matrixFile := fmt.Sprintf("%s_eyeshine.csv", m.Params.SpeciesName)
+	if err := writeSummaryMatrix(matrixFile, summaries,
+		func(s blockSummary) float64 { return s.Budget.Reflected }); err != nil {
+		return nil, err
+	}
+
+	filename := fmt.Sprintf("%s_eyeshine_angular.csv", m.Params.SpeciesName)
+	file, err := os.Create(filename)
+	if err != nil {
+		return []string{matrixFile}, fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, eyeshineAngularHeader)
+	for block, s := range summaries {
+		e := m.eyeshine(s)
+		for j, v := range e.Intensity {
+			reflected := 0.0
+			if j < len(s.Budget.ReflectedAt) {
+				reflected = s.Budget.ReflectedAt[j]
+			}
+			if _, err := fmt.Fprintf(writer, "%d,%d,%d,%d,%.4f,%.6f,%.6f\n", block, block/pigmentSteps,
+				block%pigmentSteps, j, float64(j)*m.OmmatidialAngle, reflected, v); err != nil {
+				return []string{matrixFile, filename}, fmt.Errorf("writing %s: %w", filename, err)
+			}
+		}
+	}
+	return []string{matrixFile, filename}, writer.Flush()
+}
+
+// printEyeshine prints the brightest eyeshine of any pigment state and its width.
+func (m *Model) printEyeshine(summaries []blockSummary) {
+	brightest := 0
+	for block, s := range summaries {
+		if s.Budget.Reflected > summaries[brightest].Budget.Reflected {
+			brightest = block
+		}
+	}
+	e := m.eyeshine(summaries[brightest])
+	if e.Percent <= 0 {
+		fmt.Println("Eyeshine: no pigment state returns any light out of the eye")
+		return
+	}
+	width := "undefined"
+	if !math.IsNaN(e.FWHMDegrees) {
+		width = fmt.Sprintf("%.4f deg", e.FWHMDegrees)
+	}
+	fmt.Printf("Eyeshine: brightest %.2f%% of the incident light at block %d (shielding step %d, tapetal step %d), width %s\n",
+		e.Percent, brightest, brightest/pigmentSteps, brightest%pigmentSteps, width)
+}
@@ -0,0 +1,49 @@
+// FILE: eyeshine_test.go
+// This file contains tests for the eyeshine prediction in eyeshine.go
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestEyeshine checks that eyeshine appears only where the tapetum is exposed, and
+// that its angular distribution accounts for all of it.
+func TestEyeshine(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_eyeshine"))
+	summaries := model.simulate(nil)
+
+	for block, s := range summaries {
+		e := model.eyeshine(s)
+		exposed := s.Shielding == 0 && s.Tapetal > 0
+		if exposed != (e.Percent > 0) {
+			t.Errorf("Block %d (shielding %f, tapetal %f): expected eyeshine %t, got %f%%",
+				block, s.Shielding, s.Tapetal, exposed, e.Percent)
+		}
+		if !exposed {
+			if len(e.Intensity) != 0 {
+				t.Errorf("Block %d: expected no angular distribution, got %v", block, e.Intensity)
+			}
+			continue
+		}
+
+		total := 0.0
+		for _, v := range s.Budget.ReflectedAt {
+			total += v
+		}
+		if math.Abs(total-e.Percent) > 1e-9 {
+			t.Errorf("Block %d: angular distribution sums to %f%%, expected %f%%", block, total, e.Percent)
+		}
+		peak := 0.0
+		for _, v := range e.Intensity {
+			peak = math.Max(peak, v)
+		}
+		if peak != 1 {
+			t.Errorf("Block %d: expected the intensity to peak at 1, got %f", block, peak)
+		}
+		if math.IsNaN(e.FWHMDegrees) || e.FWHMDegrees <= 0 {
+			t.Errorf("Block %d: expected a width for the eyeshine, got %f", block, e.FWHMDegrees)
+		}
+	}
+}
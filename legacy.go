@@ -0,0 +1,168 @@
+// FILE: legacy.go
+// This file contains the legacy algorithm, a reimplementation of the calculation used
+// by releases before 0.6 so that previously published results can be reproduced.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// legacyRhabdoms is the length of the fixed absorption profile used by earlier
+// releases. Light landing beyond it was silently discarded.
+const legacyRhabdoms = 21
+
+// legacySummary is the resolution and sensitivity of one pigment state as earlier
+// releases reported them.
+type legacySummary struct {
+	// Resolution is the acceptance angle in centidegrees, int(200 × half-width).
+	Resolution int
+	// Sensitivity is the percentage absorbed, truncated to an integer.
+	Sensitivity int
+	// HalfWidthDegrees and SensitivityPercent are the same values before truncation.
+	HalfWidthDegrees   float64
+	SensitivityPercent float64
+}
+
+// legacyBlurOffset is the whole-rhabdom displacement earlier releases gave the image
+// formed by a facet: one rhabdom for each multiple of NumberOfFacets/BlurCircleExtent
+// the facet index exceeds, tested as a chain of `facet > fd*i` comparisons.
+func (m *Model) legacyBlurOffset(facetIndex int) int {
+	fd := float64(m.NumberOfFacets) / m.Params.BlurCircleExtent
+	offset := 0
+	for i := 1; float64(i) < m.Params.BlurCircleExtent; i++ {
+		if float64(facetIndex) > fd*float64(i) {
+			offset++
+		}
+	}
+	return offset
+}
+
+// simulateLegacy runs every pigment state through the legacy algorithm. The ray
+// trace itself is the current one, fed with the legacy blur offsets, so the two
+// algorithms differ only in the steps that changed in 0.6:
+//
+//   - blur offsets are quantised to whole rhabdoms;
+//   - facet transmission scales the path length before absorption, rather than the
+//     light absorbed;
+//   - the profile is truncated at 21 rhabdom offsets;
+//   - the point spread function is the light absorbed at each offset, with no
+//     weighting by the annulus each facet samples or the annulus the light is spread
+//     over, while sensitivity weights each facet by its annulus.
+func (m *Model) simulateLegacy() []legacySummary {
+	summaries := make([]legacySummary, 0, pigmentSteps*pigmentSteps)
+	for block := 0; block < pigmentSteps*pigmentSteps; block++ {
+		shielding, tapetal := m.pigmentPositions(block)
+
+		var profile legacyProfile
+		for facet := 0; facet < m.NumberOfFacets; facet++ {
+			trace := m.traceRayWithOffset(facet, shielding, tapetal, float64(m.legacyBlurOffset(facet)))
+			transmission := m.facetTransmission(facet)
+			folded := make([]float64, len(trace.Pathlengths))
+			for i, v := range trace.Pathlengths {
+				folded[i] = v * transmission
+			}
+			m.legacyAccumulate(&profile, facet, folded)
+		}
+		summaries = append(summaries, m.summariseLegacyBlock(profile))
+	}
+	return summaries
+}
+
+// legacyProfile is the absorbed light at each rhabdom offset, as earlier releases
+// accumulated it: Plain is unweighted, for the point spread function, and Weighted
+// weights each facet by its annulus, for sensitivity.
+type legacyProfile struct {
+	Plain, Weighted [legacyRhabdoms]float64
+}
+
+// legacyAccumulate adds one facet's ray into a legacy profile. The path lengths must
+// already have the facet transmission folded in, as earlier releases recorded them.
+func (m *Model) legacyAccumulate(profile *legacyProfile, facetIndex int, folded []float64) {
+	offset := m.legacyBlurOffset(facetIndex)
+	tot := 0.0
+	for rhabdom, pathlength := range folded {
+		absorbed := (1.0 - tot) * (1.0 - math.Exp(-absorptionCoefficient*pathlength))
+		tot += absorbed
+		if j := offset + rhabdom; j < legacyRhabdoms {
+			profile.Plain[j] += 100.0 * absorbed
+			profile.Weighted[j] += 100.0 * absorbed * ringArea(facetIndex)
+		}
+	}
+}
+
+// summariseLegacyBlock reduces the legacy profiles of one pigment state to resolution
+// and sensitivity. Unlike summariseBlock it never reports NaN: a profile with no light
+// has a resolution of 0, and an annular profile reports the outer edge of its ring.
+func (m *Model) summariseLegacyBlock(profile legacyProfile) legacySummary {
+	var out legacySummary
+	total := 0.0
+	for _, v := range profile.Weighted {
+		total += v
+	}
+	out.SensitivityPercent = total / (math.Pi * math.Pow(float64(m.NumberOfFacets)-0.5, 2))
+	out.Sensitivity = int(out.SensitivityPercent)
+
+	psf := append(profile.Plain[:], 0)
+	peak := 0
+	for j, v := range psf {
+		if v > psf[peak] {
+			peak = j
+		}
+	}
+	if psf[peak] <= 0 {
+		return out
+	}
+	half := psf[peak] / 2.0
+	for i := 0; i < len(psf)-1; i++ {
+		if psf[i] >= half && psf[i+1] < half {
+			frac := (psf[i] - half) / (psf[i] - psf[i+1])
+			out.HalfWidthDegrees = (float64(i) + frac) * m.OmmatidialAngle
+			break
+		}
+	}
+	out.Resolution = int(200.0 * out.HalfWidthDegrees)
+	return out
+}
+
+// writeLegacySummaries writes {prefix}_res.csv and {prefix}_sen.csv: integer matrices
+// in the pre-0.6 units, laid out like the current ones, and returns the names of the
+// files.
+func writeLegacySummaries(prefix string, summaries []legacySummary) ([]string, error) {
+	var written []string
+	for _, q := range []struct {
+		suffix string
+		value  func(legacySummary) int
+	}{
+		{"res", func(s legacySummary) int { return s.Resolution }},
+		{"sen", func(s legacySummary) int { return s.Sensitivity }},
+	} {
+		filename := fmt.Sprintf("%s_%s.csv", prefix, q.suffix)
+		file, err := os.Create(filename)
+		if err != nil {
+			return written, fmt.Errorf("creating %s: %w", filename, err)
+		}
+		written = append(written, filename)
+		writer := bufio.NewWriter(file)
+		for row := 0; row < pigmentSteps; row++ {
+			cells := make([]string, pigmentSteps)
+			for col := range cells {
+				cells[col] = strconv.Itoa(q.value(summaries[row*pigmentSteps+col]))
+			}
+			fmt.Fprintln(writer, strings.Join(cells, ","))
+		}
+		if err := writer.Flush(); err != nil {
+			file.Close()
+			return written, fmt.Errorf("writing %s: %w", filename, err)
+		}
+		if err := file.Close(); err != nil {
+			return written, fmt.Errorf("writing %s: %w", filename, err)
+		}
+	}
+	return written, nil
+}
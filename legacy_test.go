@@ -0,0 +1,55 @@
+// FILE: legacy_test.go
+// This file contains tests for the legacy algorithm in legacy.go
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestLegacyReferenceValues checks the legacy algorithm against the values earlier
+// releases published for Nephrops flat lateral, dark-adapted, alongside the values
+// the current model gives for the same eye.
+func TestLegacyReferenceValues(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_legacy"))
+
+	legacy := model.simulateLegacy()
+	if len(legacy) != pigmentSteps*pigmentSteps {
+		t.Fatalf("Expected %d legacy pigment states, got %d", pigmentSteps*pigmentSteps, len(legacy))
+	}
+	if legacy[0].Resolution != 833 {
+		t.Errorf("Expected the legacy dark-adapted resolution of 833 centidegrees, got %d", legacy[0].Resolution)
+	}
+	if legacy[0].Sensitivity != 78 {
+		t.Errorf("Expected the legacy dark-adapted sensitivity of 78%%, got %d", legacy[0].Sensitivity)
+	}
+
+	current := model.simulate(nil)
+	if math.Abs(current[0].FWHMDegrees-9.58) > 0.005 {
+		t.Errorf("Expected the current dark-adapted resolution of 9.58 deg, got %.4f", current[0].FWHMDegrees)
+	}
+	if math.Abs(current[0].SensitivityPercent-83.03) > 0.005 {
+		t.Errorf("Expected the current dark-adapted sensitivity of 83.03%%, got %.4f", current[0].SensitivityPercent)
+	}
+}
+
+// TestLegacyBlurOffset checks that the legacy offsets step in whole rhabdoms from 0
+// on the axis, never fall back, and stay within the blur circle.
+func TestLegacyBlurOffset(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_legacy"))
+	prev := 0
+	for facet := 0; facet < model.NumberOfFacets; facet++ {
+		offset := model.legacyBlurOffset(facet)
+		if facet == 0 && offset != 0 {
+			t.Errorf("Expected the axial facet to have no offset, got %d", offset)
+		}
+		if offset < prev || offset > prev+1 {
+			t.Errorf("Facet %d: expected an offset of %d or %d, got %d", facet, prev, prev+1, offset)
+		}
+		if float64(offset) > model.Params.BlurCircleExtent-1 {
+			t.Errorf("Facet %d: offset %d lies outside the blur circle", facet, offset)
+		}
+		prev = offset
+	}
+}
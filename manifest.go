@@ -0,0 +1,176 @@
+// FILE: manifest.go
+// This file contains the run manifest, which records what produced a set of outputs
+// and a checksum of each so that the outputs can later be verified.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// manifestSchemaVersion identifies the layout of manifest.json, as for the results
+// files.
+const manifestSchemaVersion = 1
+
+// manifestFile is the JSON document written to manifest.json at the end of each run.
+type manifestFile struct {
+	SchemaVersion  int               `json:"schema_version"`
+	ProgramVersion string            `json:"program_version"`
+	GoVersion      string            `json:"go_version"`
+	CommandLine    []string          `json:"command_line"`
+	StartedAt      time.Time         `json:"started_at"`
+	FinishedAt     time.Time         `json:"finished_at"`
+	ParameterFile  manifestEntry     `json:"parameter_file"`
+	Constants      constantsJSON     `json:"constants"`
+	Species        []manifestSpecies `json:"species"`
+	// Skipped lists the parameter sets that could not be simulated, and why.
+	Skipped []string        `json:"skipped"`
+	Outputs []manifestEntry `json:"outputs"`
+}
+
+// manifestSpecies records one simulated parameter set as it was parsed.
+type manifestSpecies struct {
+	Parameters parametersJSON `json:"parameters"`
+	Geometry   geometryJSON   `json:"geometry"`
+}
+
+// manifestEntry is a file and its checksum. Paths are as the run wrote them, relative
+// to the directory the manifest is in unless absolute.
+type manifestEntry struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// newRunManifest starts the manifest for a run of the given parameter file.
+func newRunManifest(parameterFile string, args []string) *manifestFile {
+	return &manifestFile{
+		SchemaVersion:  manifestSchemaVersion,
+		ProgramVersion: version,
+		GoVersion:      runtime.Version(),
+		CommandLine:    args,
+		StartedAt:      time.Now().UTC(),
+		ParameterFile:  manifestEntry{Path: parameterFile},
+		Constants:      newConstantsJSON(),
+		Species:        []manifestSpecies{},
+		Skipped:        []string{},
+		Outputs:        []manifestEntry{},
+	}
+}
+
+// addSpecies records a parameter set that was simulated, along with the files its
+// simulation wrote.
+func (r *manifestFile) addSpecies(m *Model, outputs []string) {
+	r.Species = append(r.Species, manifestSpecies{
+		Parameters: newParametersJSON(m.Params),
+		Geometry:   m.newGeometryJSON(),
+	})
+	for _, name := range outputs {
+		r.Outputs = append(r.Outputs, manifestEntry{Path: name})
+	}
+}
+
+// addOutputs records files written for the run as a whole.
+func (r *manifestFile) addOutputs(outputs ...string) {
+	for _, name := range outputs {
+		r.Outputs = append(r.Outputs, manifestEntry{Path: name})
+	}
+}
+
+// hashFile returns the SHA-256 of a file, as hex, and its size.
+func hashFile(name string) (string, int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, fmt.Errorf("reading %s: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// write checksums the parameter file and every output and writes the manifest.
+func (r *manifestFile) write(filename string) error {
+	r.FinishedAt = time.Now().UTC()
+	entries := []*manifestEntry{&r.ParameterFile}
+	for i := range r.Outputs {
+		entries = append(entries, &r.Outputs[i])
+	}
+	for _, e := range entries {
+		sum, size, err := hashFile(e.Path)
+		if err != nil {
+			return fmt.Errorf("checksumming for the manifest: %w", err)
+		}
+		e.SHA256, e.Bytes = sum, size
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", filename, err)
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", filename, err)
+	}
+	return nil
+}
+
+// manifestProblem is a file whose contents no longer match the manifest.
+type manifestProblem struct {
+	Path string
+	Err  error
+}
+
+var (
+	errFileMissing  = errors.New("missing")
+	errFileModified = errors.New("contents differ from the manifest")
+)
+
+// verifyManifest checks the parameter file and every output recorded in a manifest
+// against their checksums, resolving relative paths from the manifest's directory.
+// It returns the manifest and every file that no longer matches.
+func verifyManifest(filename string) (manifestFile, []manifestProblem, error) {
+	var m manifestFile
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return m, nil, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, nil, fmt.Errorf("decoding %s: %w", filename, err)
+	}
+	if m.SchemaVersion != manifestSchemaVersion {
+		return m, nil, fmt.Errorf("%s has schema version %d, but this release reads version %d",
+			filename, m.SchemaVersion, manifestSchemaVersion)
+	}
+
+	dir := filepath.Dir(filename)
+	var problems []manifestProblem
+	for _, e := range append([]manifestEntry{m.ParameterFile}, m.Outputs...) {
+		path := e.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		sum, size, err := hashFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			problems = append(problems, manifestProblem{e.Path, errFileMissing})
+		case err != nil:
+			problems = append(problems, manifestProblem{e.Path, err})
+		case sum != e.SHA256 || size != e.Bytes:
+			problems = append(problems, manifestProblem{e.Path, errFileModified})
+		}
+	}
+	return m, problems, nil
+}
@@ -0,0 +1,102 @@
+// FILE: manifest_test.go
+// This file contains tests for the run manifest in manifest.go
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestManifestVerify checks that a manifest verifies against the files it was written
+// from, from any directory, and that changing or removing one of them is reported.
+func TestManifestVerify(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for _, name := range []string{"params.txt", "output.csv", "removed.csv"} {
+		if err := os.WriteFile(name, []byte(name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest := newRunManifest("params.txt", []string{"pathlength", "run", "-f", "params.txt"})
+	manifest.addSpecies(mustModel(t, nephropsFlatLateral("test_manifest")), nil)
+	manifest.addOutputs("output.csv", "removed.csv")
+	if err := manifest.write("manifest.json"); err != nil {
+		t.Fatalf("write returned an unexpected error: %v", err)
+	}
+
+	t.Chdir(os.TempDir())
+	filename := filepath.Join(dir, "manifest.json")
+	got, problems, err := verifyManifest(filename)
+	if err != nil {
+		t.Fatalf("verifyManifest returned an unexpected error: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("Expected every file to match, got %v", problems)
+	}
+	if len(got.Species) != 1 || got.Species[0].Parameters.SpeciesName != "test_manifest" {
+		t.Errorf("Expected the manifest to record the species, got %+v", got.Species)
+	}
+	if got.ParameterFile.SHA256 == "" || len(got.Outputs) != 2 {
+		t.Errorf("Expected the parameter file and two outputs to be checksummed, got %+v and %+v",
+			got.ParameterFile, got.Outputs)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "output.csv"), []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "removed.csv")); err != nil {
+		t.Fatal(err)
+	}
+	_, problems, err = verifyManifest(filename)
+	if err != nil {
+		t.Fatalf("verifyManifest returned an unexpected error: %v", err)
+	}
+	if len(problems) != 2 ||
+		problems[0].Path != "output.csv" || !errors.Is(problems[0].Err, errFileModified) ||
+		problems[1].Path != "removed.csv" || !errors.Is(problems[1].Err, errFileMissing) {
+		t.Errorf("Expected output.csv modified and removed.csv missing, got %v", problems)
+	}
+}
+
+// TestRunManifestListsEveryOutput checks that a run with every optional output records
+// each file it writes in the manifest, and nothing it did not write.
+func TestRunManifestListsEveryOutput(t *testing.T) {
+	paramFile, err := filepath.Abs("example_data/nephrops_parameters.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	if err := runCommand(flag.NewFlagSet("run", flag.ContinueOnError),
+		[]string{"-f", paramFile, "-d", "-compat", "-legacy"}); err != nil {
+		t.Fatalf("run returned an unexpected error: %v", err)
+	}
+
+	m, problems, err := verifyManifest("manifest.json")
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("Expected the manifest to verify, got %v and %v", problems, err)
+	}
+	var recorded []string
+	for _, e := range m.Outputs {
+		recorded = append(recorded, e.Path)
+	}
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written []string
+	for _, e := range entries {
+		if e.Name() != "manifest.json" {
+			written = append(written, e.Name())
+		}
+	}
+	slices.Sort(recorded)
+	if !slices.Equal(recorded, written) {
+		t.Errorf("Expected the manifest to record the files written:\n%v\ngot:\n%v", written, recorded)
+	}
+}
@@ -25,6 +25,43 @@ type Parameters struct {
 	ProximalRhabdomAngle     float64
 }
 
+// parameterField describes one numeric column of the parameter file.
+type parameterField struct {
+	// Name is the Parameters field name, used to refer to the column on the command
+	// line and in diagnostics.
+	Name string
+	// Label is the lower-case description used in error messages.
+	Label string
+	// Unit is the unit the value is given in, empty for dimensionless values.
+	Unit string
+	// Value returns a pointer to the field within a parameter set.
+	Value func(*Parameters) *float64
+}
+
+// parameterFields lists the numeric parameters in the order they appear in the
+// parameter file, after the species name.
+var parameterFields = []parameterField{
+	{"RhabdomLength", "rhabdom length", "um", func(p *Parameters) *float64 { return &p.RhabdomLength }},
+	{"RhabdomWidth", "rhabdom width", "um", func(p *Parameters) *float64 { return &p.RhabdomWidth }},
+	{"EyeDiameter", "eye diameter", "um", func(p *Parameters) *float64 { return &p.EyeDiameter }},
+	{"FacetWidth", "facet width", "um", func(p *Parameters) *float64 { return &p.FacetWidth }},
+	{"ApertureDiameter", "aperture diameter", "um", func(p *Parameters) *float64 { return &p.ApertureDiameter }},
+	{"CytoplasmRefractiveIndex", "cytoplasm refractive index", "", func(p *Parameters) *float64 { return &p.CytoplasmRefractiveIndex }},
+	{"RhabdomRefractiveIndex", "rhabdom refractive index", "", func(p *Parameters) *float64 { return &p.RhabdomRefractiveIndex }},
+	{"BlurCircleExtent", "blur circle extent", "rhabdoms", func(p *Parameters) *float64 { return &p.BlurCircleExtent }},
+	{"ProximalRhabdomAngle", "proximal rhabdom angle", "deg", func(p *Parameters) *float64 { return &p.ProximalRhabdomAngle }},
+}
+
+// lookupParameterField finds a numeric parameter by its field name, ignoring case.
+func lookupParameterField(name string) (parameterField, bool) {
+	for _, f := range parameterFields {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return parameterField{}, false
+}
+
 // Model holds the calculated parameters and state of the simulation.
 type Model struct {
 	Params             Parameters
@@ -39,6 +76,11 @@ type Model struct {
 	RhabdomRadius      float64
 	CriticalAngle      float64
 	DebugMode          bool
+	// CompatMode also writes the pathlengths in the pre-0.6 layout.
+	CompatMode bool
+	// DepthBin is the width, in micrometres, of the bins the axial absorption profile
+	// is divided into from the distal tip.
+	DepthBin float64
 }
 
 const (
@@ -62,7 +104,7 @@ func NewModel(params Parameters) (*Model, error) {
 	if err := validateParameters(params); err != nil {
 		return nil, err
 	}
-	m := &Model{Params: params}
+	m := &Model{Params: params, DepthBin: defaultDepthBin}
 	m.initialCalculations()
 	if err := m.validateGeometry(); err != nil {
 		return nil, err
@@ -70,89 +112,125 @@ func NewModel(params Parameters) (*Model, error) {
 	return m, nil
 }
 
-// validateParameters rejects inputs that would produce NaNs or nonsensical optics.
+// parameterProblem is one reason a parameter set cannot describe a realisable eye.
+type parameterProblem struct {
+	// Field is the Parameters field at fault, or empty when the problem lies in the
+	// combination of several.
+	Field string
+	Err   error
+	// Fix suggests a change that would resolve the problem.
+	Fix string
+}
+
+// validateParameters rejects inputs that would produce NaNs or nonsensical optics,
+// returning the first problem found.
 func validateParameters(p Parameters) error {
+	if problems := checkParameters(p); len(problems) > 0 {
+		return problems[0].Err
+	}
+	return nil
+}
+
+// checkParameters returns every problem with a parameter set, so that a file can be
+// corrected in one pass rather than one rejection at a time.
+func checkParameters(p Parameters) []parameterProblem {
+	var problems []parameterProblem
+	add := func(field, fix, format string, args ...any) {
+		problems = append(problems, parameterProblem{Field: field, Err: fmt.Errorf(format, args...), Fix: fix})
+	}
+
 	if strings.TrimSpace(p.SpeciesName) == "" {
-		return fmt.Errorf("species name is required")
+		add("SpeciesName", "give the parameter set a unique name", "species name is required")
 	}
 	// Reject non-finite values before any range check. strconv.ParseFloat accepts
 	// "NaN" and "Inf", and every ordered comparison against NaN is false, so a NaN
 	// would slip past the constraints below and reappear as an undefined critical
 	// angle or blur offset - reproducing the very silent failures the range checks
 	// exist to prevent.
-	for _, c := range []struct {
-		name string
-		v    float64
-	}{
-		{"rhabdom length", p.RhabdomLength},
-		{"rhabdom width", p.RhabdomWidth},
-		{"eye diameter", p.EyeDiameter},
-		{"facet width", p.FacetWidth},
-		{"aperture diameter", p.ApertureDiameter},
-		{"cytoplasm refractive index", p.CytoplasmRefractiveIndex},
-		{"rhabdom refractive index", p.RhabdomRefractiveIndex},
-		{"blur circle extent", p.BlurCircleExtent},
-		{"proximal rhabdom angle", p.ProximalRhabdomAngle},
-	} {
-		if math.IsNaN(c.v) || math.IsInf(c.v, 0) {
-			return fmt.Errorf("%s must be a finite number, got %g", c.name, c.v)
+	finite := map[string]bool{}
+	for _, f := range parameterFields {
+		v := *f.Value(&p)
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			add(f.Name, "replace it with a finite number", "%s must be a finite number, got %g", f.Label, v)
+			continue
 		}
+		finite[f.Name] = true
 	}
 
-	for _, c := range []struct {
-		name string
-		v    float64
-	}{
-		{"rhabdom length", p.RhabdomLength},
-		{"rhabdom width", p.RhabdomWidth},
-		{"eye diameter", p.EyeDiameter},
-		{"facet width", p.FacetWidth},
-		{"aperture diameter", p.ApertureDiameter},
-	} {
-		if c.v <= 0 {
-			return fmt.Errorf("%s must be greater than 0 um, got %g", c.name, c.v)
+	for _, f := range parameterFields {
+		if v := *f.Value(&p); f.Unit == "um" && finite[f.Name] && v <= 0 {
+			add(f.Name, "use a positive length in micrometres", "%s must be greater than 0 um, got %g", f.Label, v)
 		}
 	}
-	if p.ApertureDiameter >= p.EyeDiameter {
-		return fmt.Errorf("aperture diameter (%g um) must be smaller than eye diameter (%g um)",
+	if finite["ApertureDiameter"] && finite["EyeDiameter"] && p.EyeDiameter > 0 &&
+		p.ApertureDiameter >= p.EyeDiameter {
+		add("ApertureDiameter", fmt.Sprintf("use an aperture diameter below the eye diameter of %g um", p.EyeDiameter),
+			"aperture diameter (%g um) must be smaller than eye diameter (%g um)",
 			p.ApertureDiameter, p.EyeDiameter)
 	}
-	if p.CytoplasmRefractiveIndex <= 1.0 {
-		return fmt.Errorf("cytoplasm refractive index must be greater than 1.0, got %g",
-			p.CytoplasmRefractiveIndex)
+	if finite["CytoplasmRefractiveIndex"] && p.CytoplasmRefractiveIndex <= 1.0 {
+		add("CytoplasmRefractiveIndex", "crustacean cytoplasm is typically about 1.34",
+			"cytoplasm refractive index must be greater than 1.0, got %g", p.CytoplasmRefractiveIndex)
 	}
 	// Without n_rhabdom > n_cytoplasm there is no waveguiding and no critical angle:
 	// asin(n_cyt/n_rhab) would be NaN and every total-internal-reflection test would
 	// silently evaluate to false.
-	if p.RhabdomRefractiveIndex <= p.CytoplasmRefractiveIndex {
-		return fmt.Errorf("rhabdom refractive index (%g) must exceed cytoplasm refractive index (%g) for total internal reflection",
+	if finite["RhabdomRefractiveIndex"] && finite["CytoplasmRefractiveIndex"] &&
+		p.RhabdomRefractiveIndex <= p.CytoplasmRefractiveIndex {
+		add("RhabdomRefractiveIndex",
+			fmt.Sprintf("use a rhabdom refractive index above %g; crustacean rhabdoms are typically about 1.37",
+				p.CytoplasmRefractiveIndex),
+			"rhabdom refractive index (%g) must exceed cytoplasm refractive index (%g) for total internal reflection",
 			p.RhabdomRefractiveIndex, p.CytoplasmRefractiveIndex)
 	}
-	if p.BlurCircleExtent < 1 {
-		return fmt.Errorf("blur circle extent must be at least 1 rhabdom, got %g", p.BlurCircleExtent)
+	if finite["BlurCircleExtent"] && p.BlurCircleExtent < 1 {
+		add("BlurCircleExtent", "use 1 for a perfect point focus",
+			"blur circle extent must be at least 1 rhabdom, got %g", p.BlurCircleExtent)
 	}
-	if p.ProximalRhabdomAngle < 0 {
-		return fmt.Errorf("proximal rhabdom angle must not be negative, got %g", p.ProximalRhabdomAngle)
+	if finite["ProximalRhabdomAngle"] && p.ProximalRhabdomAngle < 0 {
+		add("ProximalRhabdomAngle", "use 0 for flat-ended rhabdoms",
+			"proximal rhabdom angle must not be negative, got %g", p.ProximalRhabdomAngle)
 	}
-	return nil
+	return problems
 }
 
-// validateGeometry checks the values derived from the parameters.
+// validateGeometry checks the values derived from the parameters, returning the first
+// problem found.
 func (m *Model) validateGeometry() error {
+	if problems := m.checkGeometry(); len(problems) > 0 {
+		return problems[0].Err
+	}
+	return nil
+}
+
+// checkGeometry returns every problem with the values derived from the parameters.
+func (m *Model) checkGeometry() []parameterProblem {
+	var problems []parameterProblem
 	if m.NumberOfFacets < 1 {
-		return fmt.Errorf("eyeshine patch spans no facets (aperture arc %.2f um / facet width %.2f um); "+
-			"check aperture and facet dimensions", m.ApertureArc, m.Params.FacetWidth)
+		// The patch spans at least one facet once the arc is half a facet wide.
+		problems = append(problems, parameterProblem{
+			Field: "FacetWidth",
+			Err: fmt.Errorf("eyeshine patch spans no facets (aperture arc %.2f um / facet width %.2f um); "+
+				"check aperture and facet dimensions", m.ApertureArc, m.Params.FacetWidth),
+			Fix: fmt.Sprintf("use a facet width of at most %.2f um, or a larger aperture diameter", 2*m.ApertureArc),
+		})
+		return problems
 	}
 	// The blur circle spreads the light gathered across the eyeshine patch over
 	// BlurCircleExtent rhabdoms. With more blur steps than facets, the mapping from
 	// facet to rhabdom offset leaves offsets with no contributing facet at all,
 	// producing a comb-shaped profile whose half-maximum is a binning artefact.
 	if m.Params.BlurCircleExtent > float64(m.NumberOfFacets) {
-		return fmt.Errorf("blur circle extent (%g rhabdoms) exceeds the %d facets across the eyeshine patch; "+
-			"the resulting profile would contain rhabdom offsets that receive no light",
-			m.Params.BlurCircleExtent, m.NumberOfFacets)
+		problems = append(problems, parameterProblem{
+			Field: "BlurCircleExtent",
+			Err: fmt.Errorf("blur circle extent (%g rhabdoms) exceeds the %d facets across the eyeshine patch; "+
+				"the resulting profile would contain rhabdom offsets that receive no light",
+				m.Params.BlurCircleExtent, m.NumberOfFacets),
+			Fix: fmt.Sprintf("use a blur circle extent of at most %d, the number of facets across the eyeshine patch",
+				m.NumberOfFacets),
+		})
 	}
-	return nil
+	return problems
 }
 
 // initialCalculations sets up the derived optical values of the model.
@@ -196,6 +274,12 @@ func refractedAngle(incidence float64) float64 {
 	}
 }
 
+// apertureArea is the area of the superposition aperture, the patch of facets that
+// focus light onto one rhabdom, in m².
+func (m *Model) apertureArea() float64 {
+	return math.Pi * math.Pow(m.ApertureRadius*1e-6, 2)
+}
+
 // facetTransmission is the fraction of light a facet admits at the given angle of
 // incidence, relative to a facet viewed normally. It is a flux factor in [0, 1]
 // and is applied to the absorbed intensity, not to the geometric path length.
@@ -250,17 +334,83 @@ type traceResult struct {
 	MaxAngle float64
 	// Lost is set when the ray stopped propagating towards the proximal end.
 	Lost bool
+	// Fate is where the light the ray did not absorb ends up, one of the fate
+	// constants.
+	Fate string
+	// Segments breaks the path down into its straight legs. The legs in rhabdom i
+	// sum to Pathlengths[i].
+	Segments []raySegment
+}
+
+// Kinds of ray segment, by the direction of travel and what has reflected the ray.
+const (
+	// segmentIncident travels proximally before any reflection.
+	segmentIncident = "incident"
+	// segmentReflected travels proximally after reflecting off the rhabdom wall.
+	segmentReflected = "reflected"
+	// segmentReturn travels back distally after reflecting off the tapetum.
+	segmentReturn = "return"
+)
+
+// Fates of the light a ray carries past the last rhabdom it is traced through.
+const (
+	// fateScreening is absorbed by the proximal screening pigment, which lies over
+	// the tapetum wherever it is extended.
+	fateScreening = "screening"
+	// fateReflected is returned distally by the tapetum and leaves through the
+	// aperture. A C1 ray stopped by the tapetal pigment has its return leg untraced,
+	// so it absorbs nothing more on the way out.
+	fateReflected = "reflected"
+	// fateLost turned 90 degrees or more to the rhabdom axis.
+	fateLost = "lost"
+	// fateTransmitted leaves the proximal end of the array, with neither pigment in
+	// its way.
+	fateTransmitted = "transmitted"
+)
+
+// exitFate is where the light left in a ray goes once the trace reaches the proximal
+// pigments or the base of the array.
+func exitFate(shielding, tapetal float64) string {
+	switch {
+	case shielding > 0:
+		return fateScreening
+	case tapetal > 0:
+		return fateReflected
+	default:
+		return fateTransmitted
+	}
+}
+
+// raySegment is one straight leg of a traced ray. Depths are measured along the
+// rhabdom axis from the distal tip, so a return leg has EndDepth < StartDepth.
+type raySegment struct {
+	// Rhabdom is the index along the ray of the rhabdom the leg lies in, 0 being the
+	// first entered, matching the index into Pathlengths.
+	Rhabdom    int
+	Kind       string
+	StartDepth float64
+	EndDepth   float64
+	// Angle is the angle to the rhabdom axis, in degrees.
+	Angle float64
+	// Length is the path length of the leg, in micrometres.
+	Length float64
 }
 
 // traceRay follows a single ray from the given facet through the rhabdom array for
 // one combination of pigment positions.
 func (m *Model) traceRay(facetIndex int, shielding, tapetal float64) traceResult {
+	return m.traceRayWithOffset(facetIndex, shielding, tapetal, m.blurOffset(facetIndex))
+}
+
+// traceRayWithOffset traces a ray whose image is displaced by the given blur offset,
+// in rhabdoms, so that the legacy algorithm can supply its quantised offsets.
+func (m *Model) traceRayWithOffset(facetIndex int, shielding, tapetal, offset float64) traceResult {
 	p := m.Params
-	res := traceResult{}
+	res := traceResult{Fate: exitFate(shielding, tapetal)}
 
 	// Angle to the rhabdom axis on entry: corneal refraction plus the blur-circle
 	// displacement, which tilts the ray by one ommatidial angle per rhabdom offset.
-	boa := refractedAngle(float64(facetIndex)*m.OmmatidialAngle) + m.blurOffset(facetIndex)*m.OmmatidialAngle
+	boa := refractedAngle(float64(facetIndex)*m.OmmatidialAngle) + offset*m.OmmatidialAngle
 
 	rhabdomLength := p.RhabdomLength
 	cz := 0
@@ -281,17 +431,29 @@ func (m *Model) traceRay(facetIndex int, shielding, tapetal float64) traceResult
 		if boa >= maxPropagationAngle || math.IsNaN(boa) {
 			res.TerminalCase = "lost"
 			res.Lost = true
+			res.Fate = fateLost
 			return res
 		}
 		if boa > res.MaxAngle {
 			res.MaxAngle = boa
 		}
 
+		// Index of the rhabdom the ray is in, and the depth at which it entered it.
+		rhabdom := len(res.Pathlengths)
+		depth := p.RhabdomLength - rhabdomLength
+		segment := func(kind string, start, end, length float64) {
+			res.Segments = append(res.Segments, raySegment{
+				Rhabdom: rhabdom, Kind: kind, StartDepth: start, EndDepth: end, Angle: boa, Length: length,
+			})
+		}
+
 		if facetIndex == 0 {
 			// CASE 4: axial ray. Equivalent to case 3 at boa = 0, kept explicit.
 			val := rhabdomLength
+			segment(segmentIncident, depth, p.RhabdomLength, rhabdomLength)
 			if tapetal > 0 && shielding == 0 {
 				val = rhabdomLength * 2.0
+				segment(segmentReturn, p.RhabdomLength, depth, rhabdomLength)
 			}
 			res.Pathlengths = append(res.Pathlengths, val)
 			res.TerminalCase = "C4"
@@ -312,8 +474,10 @@ func (m *Model) traceRay(facetIndex int, shielding, tapetal float64) traceResult
 			x := rhabdomLength / cos
 			v := p.RhabdomLength / cos
 			val := x
+			segment(segmentIncident, depth, p.RhabdomLength, x)
 			if tapetal > 0 && shielding == 0 {
 				val = x + v
+				segment(segmentReturn, p.RhabdomLength, 0, v)
 			}
 			res.Pathlengths = append(res.Pathlengths, val)
 			res.TerminalCase = "C3"
@@ -326,8 +490,10 @@ func (m *Model) traceRay(facetIndex int, shielding, tapetal float64) traceResult
 
 			// A guided ray never leaves the rhabdom, so the proximal screening
 			// pigment - which lies in the cytoplasm outside the rhabdom - cannot
-			// absorb it. An unguided ray exits through the wall and is absorbed
-			// where the pigment starts.
+			// absorb it along the wall, and it runs on to the base. There the
+			// pigment lies over the tapetum and absorbs it, as it does C3 and C4
+			// rays, so its fate is still screening. An unguided ray exits through
+			// the wall and is absorbed where the pigment starts.
 			guided := boa < m.CriticalAngle
 			axial := rhabdomLength - y
 			if shielding > 0 && !guided {
@@ -337,8 +503,13 @@ func (m *Model) traceRay(facetIndex int, shielding, tapetal float64) traceResult
 			v := p.RhabdomLength / cos
 
 			val := x + z
+			segment(segmentIncident, depth, depth+y, x)
+			if z > 0 {
+				segment(segmentReflected, depth+y, depth+y+axial, z)
+			}
 			if tapetal > 0 && shielding == 0 {
 				val = x + z + v
+				segment(segmentReturn, p.RhabdomLength, 0, v)
 			}
 			res.Pathlengths = append(res.Pathlengths, val)
 			res.TerminalCase = "C2"
@@ -347,6 +518,7 @@ func (m *Model) traceRay(facetIndex int, shielding, tapetal float64) traceResult
 		default:
 			// CASE 1: no reflection. The ray crosses the wall into the adjacent
 			// rhabdom, and the inter-rhabdom angle steps by one ommatidial angle.
+			segment(segmentIncident, depth, depth+y, m.RhabdomRadius/sin)
 			res.Pathlengths = append(res.Pathlengths, m.RhabdomRadius/sin)
 			rhabdomLength -= y
 			boa += m.OmmatidialAngle
@@ -364,17 +536,78 @@ func (m *Model) traceRay(facetIndex int, shielding, tapetal float64) traceResult
 // no block terminator.
 const pathlengthsHeader = "block,shielding_um,tapetal_um,facet,rhabdom,pathlength_um"
 
+// rayVisitor receives each ray as it is traced, along with the pigment state it was
+// traced under.
+type rayVisitor func(block int, shielding, tapetal float64, facet int, trace traceResult)
+
+// pigmentPositions returns the shielding and tapetal pigment positions of a block, in
+// micrometres, in the order the simulation visits them.
+func (m *Model) pigmentPositions(block int) (shielding, tapetal float64) {
+	increment := m.Params.RhabdomLength / float64(pigmentSteps-1)
+	return float64(block/pigmentSteps) * increment, float64(block%pigmentSteps) * increment
+}
+
+// simulate traces every facet through every pigment state and returns the resolution
+// and sensitivity of each state, in block order. visit, if not nil, sees every ray as
+// it is traced, so callers can record the raw geometry without tracing it twice.
+func (m *Model) simulate(visit rayVisitor) []blockSummary {
+	summaries := make([]blockSummary, 0, pigmentSteps*pigmentSteps)
+	for block := 0; block < pigmentSteps*pigmentSteps; block++ {
+		shielding, tapetal := m.pigmentPositions(block)
+		summaries = append(summaries, m.simulateState(block, shielding, tapetal, visit))
+	}
+	return summaries
+}
+
+// simulateState traces every facet through one pigment state, which need not lie on
+// the grid of blocks, and summarises it. The block is only passed on to visit.
+func (m *Model) simulateState(block int, shielding, tapetal float64, visit rayVisitor) blockSummary {
+	// Area-weighted absorbed light at each rhabdom offset from the optic axis.
+	var profile []float64
+	lost, entered, maxAngle := 0, 0, 0.0
+	var budget energyBudget
+	depth := make([]float64, m.depthBins())
+	cases := make(map[string]int)
+
+	for facet := 0; facet < m.NumberOfFacets; facet++ {
+		trace := m.traceRay(facet, shielding, tapetal)
+		if trace.Lost {
+			lost++
+		}
+		cases[trace.TerminalCase]++
+		entered += len(trace.Pathlengths)
+		maxAngle = math.Max(maxAngle, trace.MaxAngle)
+		profile = m.accumulate(profile, facet, trace.Pathlengths)
+		m.addToBudget(&budget, facet, trace)
+		m.addToDepthProfile(depth, facet, trace)
+		if visit != nil {
+			visit(block, shielding, tapetal, facet, trace)
+		}
+	}
+
+	summary := m.summariseBlock(profile)
+	summary.Shielding, summary.Tapetal, summary.LostRays = shielding, tapetal, lost
+	summary.Cases = cases
+	summary.MeanRhabdoms = float64(entered) / float64(m.NumberOfFacets)
+	summary.MaxAngle = maxAngle
+	summary.Budget = budget
+	summary.Depth = depth
+	return summary
+}
+
 // runModel executes the main simulation loop, writes the raw pathlength geometry, and
-// returns the resolution and sensitivity of each pigment state.
+// returns the resolution and sensitivity of each pigment state along with the names of
+// the files it wrote.
 //
 // The absorption profile is accumulated as the rays are traced rather than by reading
 // the file back, so the summary does not depend on the output format at all.
-func (m *Model) runModel() ([]blockSummary, error) {
+func (m *Model) runModel() ([]blockSummary, []string, error) {
 	p := m.Params
 
-	pathlengthsFile, err := os.Create(fmt.Sprintf("%s_pathlengths.csv", p.SpeciesName))
+	outputs := []string{fmt.Sprintf("%s_pathlengths.csv", p.SpeciesName)}
+	pathlengthsFile, err := os.Create(outputs[0])
 	if err != nil {
-		return nil, fmt.Errorf("creating pathlengths file: %w", err)
+		return nil, nil, fmt.Errorf("creating pathlengths file: %w", err)
 	}
 	defer pathlengthsFile.Close()
 	pathlengthsWriter := bufio.NewWriter(pathlengthsFile)
@@ -384,10 +617,12 @@ func (m *Model) runModel() ([]blockSummary, error) {
 
 	var debugWriter *bufio.Writer
 	if m.DebugMode {
-		debugFile, err := os.Create(fmt.Sprintf("%s_debug.csv", p.SpeciesName))
+		debugFilename := fmt.Sprintf("%s_debug.csv", p.SpeciesName)
+		debugFile, err := os.Create(debugFilename)
 		if err != nil {
-			return nil, fmt.Errorf("creating debug file: %w", err)
+			return nil, outputs, fmt.Errorf("creating debug file: %w", err)
 		}
+		outputs = append(outputs, debugFilename)
 		defer debugFile.Close()
 		debugWriter = bufio.NewWriter(debugFile)
 		defer debugWriter.Flush()
@@ -395,60 +630,68 @@ func (m *Model) runModel() ([]blockSummary, error) {
 			"block,shielding_um,tapetal_um,facet,incidence_deg,refracted_deg,blur_offset_rhabdoms,entry_boa_deg,facet_transmission,terminal_case,rhabdoms_entered,pathlengths_um")
 	}
 
-	incrementAmount := p.RhabdomLength / 10.0
-	lostRays := 0
-	block := 0
-	summaries := make([]blockSummary, 0, pigmentSteps*pigmentSteps)
+	// The visitor cannot return an error, so the first failed compatibility write is
+	// kept and reported once the simulation ends.
+	var compatWriter *bufio.Writer
+	var compatErr error
+	if m.CompatMode {
+		compatFilename := fmt.Sprintf("%s_compat_pathlengths.csv", p.SpeciesName)
+		compatFile, err := os.Create(compatFilename)
+		if err != nil {
+			return nil, outputs, fmt.Errorf("creating compatibility pathlengths file: %w", err)
+		}
+		outputs = append(outputs, compatFilename)
+		defer compatFile.Close()
+		compatWriter = bufio.NewWriter(compatFile)
+		defer compatWriter.Flush()
+	}
 
-	for pStep := 0; pStep < pigmentSteps; pStep++ {
-		shielding := float64(pStep) * incrementAmount
-		for tStep := 0; tStep < pigmentSteps; tStep++ {
-			tapetal := float64(tStep) * incrementAmount
-
-			// Area-weighted absorbed light at each rhabdom offset from the optic axis.
-			var profile []float64
-
-			for facet := 0; facet < m.NumberOfFacets; facet++ {
-				trace := m.traceRay(facet, shielding, tapetal)
-				if trace.Lost {
-					lostRays++
-				}
-				profile = m.accumulate(profile, facet, trace.Pathlengths)
-
-				if len(trace.Pathlengths) == 0 {
-					// A lost ray absorbs nothing, but the facet still belongs in the
-					// record, so emit an explicit zero for it.
-					fmt.Fprintf(pathlengthsWriter, "%d,%.6f,%.6f,%d,0,0.000000\n",
-						block, shielding, tapetal, facet)
-				}
-				for rhabdom, v := range trace.Pathlengths {
-					fmt.Fprintf(pathlengthsWriter, "%d,%.6f,%.6f,%d,%d,%.6f\n",
-						block, shielding, tapetal, facet, rhabdom, v)
-				}
-
-				if debugWriter != nil {
-					parts := make([]string, len(trace.Pathlengths))
-					for i, v := range trace.Pathlengths {
-						parts[i] = fmt.Sprintf("%.6f", v)
-					}
-					incidence := float64(facet) * m.OmmatidialAngle
-					fmt.Fprintf(debugWriter, "%d,%.4f,%.4f,%d,%.4f,%.4f,%.4f,%.4f,%.6f,%s,%d,%s\n",
-						block, shielding, tapetal, facet, incidence, refractedAngle(incidence),
-						m.blurOffset(facet),
-						refractedAngle(incidence)+m.blurOffset(facet)*m.OmmatidialAngle,
-						m.facetTransmission(facet), trace.TerminalCase,
-						len(trace.Pathlengths), strings.Join(parts, " "))
-				}
+	summaries := m.simulate(func(block int, shielding, tapetal float64, facet int, trace traceResult) {
+		if compatWriter != nil && compatErr == nil {
+			transmission := m.facetTransmission(facet)
+			folded := make([]float64, len(trace.Pathlengths))
+			for i, v := range trace.Pathlengths {
+				folded[i] = v * transmission
+			}
+			compatErr = writeLegacyPathlengthsLine(compatWriter, folded)
+			if compatErr == nil && facet == m.NumberOfFacets-1 {
+				_, compatErr = fmt.Fprintln(compatWriter, legacyPathlengthsTerminator)
 			}
+		}
 
-			summaries = append(summaries, m.summariseBlock(profile))
-			block++
+		if len(trace.Pathlengths) == 0 {
+			// A lost ray absorbs nothing, but the facet still belongs in the
+			// record, so emit an explicit zero for it.
+			fmt.Fprintf(pathlengthsWriter, "%d,%.6f,%.6f,%d,0,0.000000\n",
+				block, shielding, tapetal, facet)
 		}
-	}
+		for rhabdom, v := range trace.Pathlengths {
+			fmt.Fprintf(pathlengthsWriter, "%d,%.6f,%.6f,%d,%d,%.6f\n",
+				block, shielding, tapetal, facet, rhabdom, v)
+		}
+
+		if debugWriter != nil {
+			parts := make([]string, len(trace.Pathlengths))
+			for i, v := range trace.Pathlengths {
+				parts[i] = fmt.Sprintf("%.6f", v)
+			}
+			incidence := float64(facet) * m.OmmatidialAngle
+			fmt.Fprintf(debugWriter, "%d,%.4f,%.4f,%d,%.4f,%.4f,%.4f,%.4f,%.6f,%s,%d,%s\n",
+				block, shielding, tapetal, facet, incidence, refractedAngle(incidence),
+				m.blurOffset(facet),
+				refractedAngle(incidence)+m.blurOffset(facet)*m.OmmatidialAngle,
+				m.facetTransmission(facet), trace.TerminalCase,
+				len(trace.Pathlengths), strings.Join(parts, " "))
+		}
+	})
 
-	if lostRays > 0 {
-		fmt.Printf("WARNING: %d of %d rays exceeded 90 degrees to the rhabdom axis and were discarded.\n",
-			lostRays, pigmentSteps*pigmentSteps*m.NumberOfFacets)
+	if compatWriter != nil {
+		if compatErr == nil {
+			compatErr = compatWriter.Flush()
+		}
+		if compatErr != nil {
+			return nil, outputs, fmt.Errorf("writing compatibility pathlengths file: %w", compatErr)
+		}
 	}
-	return summaries, nil
+	return summaries, outputs, nil
 }
@@ -264,6 +264,47 @@ func TestGuidedRayIgnoresScreeningPigment(t *testing.T) {
 	}
 }
 
+// TestSegmentsAccountForPathlengths checks that the segment breakdown drawn in the
+// ray diagrams is the same geometry the absorption is computed from: the legs in each
+// rhabdom must sum to its path length and stay within the rhabdom's depth.
+func TestSegmentsAccountForPathlengths(t *testing.T) {
+	params := nephropsFlatLateral("test_segments")
+	params.ProximalRhabdomAngle = 12.5
+	model := mustModel(t, params)
+	increment := params.RhabdomLength / 10.0
+
+	for pStep := 0; pStep < pigmentSteps; pStep++ {
+		for tStep := 0; tStep < pigmentSteps; tStep++ {
+			for facet := 0; facet < model.NumberOfFacets; facet++ {
+				trace := model.traceRay(facet, float64(pStep)*increment, float64(tStep)*increment)
+				sums := make([]float64, len(trace.Pathlengths))
+				for _, seg := range trace.Segments {
+					if seg.Rhabdom >= len(sums) {
+						t.Fatalf("Facet %d: segment in rhabdom %d beyond the %d entered",
+							facet, seg.Rhabdom, len(sums))
+					}
+					for _, d := range []float64{seg.StartDepth, seg.EndDepth} {
+						if d < -1e-9 || d > params.RhabdomLength+1e-9 {
+							t.Fatalf("Facet %d: segment depth %f outside the rhabdom", facet, d)
+						}
+					}
+					if (seg.Kind == segmentReturn) != (seg.EndDepth < seg.StartDepth) {
+						t.Errorf("Facet %d: %s segment runs from %f to %f um",
+							facet, seg.Kind, seg.StartDepth, seg.EndDepth)
+					}
+					sums[seg.Rhabdom] += seg.Length
+				}
+				for i, want := range trace.Pathlengths {
+					if math.Abs(sums[i]-want) > 1e-9 {
+						t.Fatalf("Facet %d at pigment step (%d,%d) rhabdom %d: segments sum to %f, pathlength %f",
+							facet, pStep, tStep, i, sums[i], want)
+					}
+				}
+			}
+		}
+	}
+}
+
 func TestRunModelProducesWellFormedBlocks(t *testing.T) {
 	flat := nephropsFlatLateral("test_flat")
 	pointy := nephropsFlatLateral("test_pointy")
@@ -272,10 +313,10 @@ func TestRunModelProducesWellFormedBlocks(t *testing.T) {
 	modelFlat := mustModel(t, flat)
 	modelPointy := mustModel(t, pointy)
 
-	if _, err := modelFlat.runModel(); err != nil {
+	if _, _, err := modelFlat.runModel(); err != nil {
 		t.Fatalf("runModel(flat) failed: %v", err)
 	}
-	if _, err := modelPointy.runModel(); err != nil {
+	if _, _, err := modelPointy.runModel(); err != nil {
 		t.Fatalf("runModel(pointy) failed: %v", err)
 	}
 	defer os.Remove("test_flat_pathlengths.csv")
@@ -338,7 +379,7 @@ func TestDebugFlagOutput(t *testing.T) {
 	params := nephropsFlatLateral("test_nodebug")
 	modelNoDebug := mustModel(t, params)
 	modelNoDebug.DebugMode = false
-	if _, err := modelNoDebug.runModel(); err != nil {
+	if _, _, err := modelNoDebug.runModel(); err != nil {
 		t.Fatalf("runModel failed: %v", err)
 	}
 	defer os.Remove("test_nodebug_pathlengths.csv")
@@ -350,7 +391,7 @@ func TestDebugFlagOutput(t *testing.T) {
 	params.SpeciesName = "test_debug"
 	modelDebug := mustModel(t, params)
 	modelDebug.DebugMode = true
-	if _, err := modelDebug.runModel(); err != nil {
+	if _, _, err := modelDebug.runModel(); err != nil {
 		t.Fatalf("runModel failed: %v", err)
 	}
 	defer os.Remove("test_debug_pathlengths.csv")
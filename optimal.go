@@ -0,0 +1,187 @@
+// FILE: optimal.go
+// This file contains the search for the best pigment state: the information each state
+// can carry at a light level, the state that carries most at each, and the states that
+// trade resolution against sensitivity most efficiently.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// informationHeader labels the columns of {species}_information.csv.
+const informationHeader = "log_irradiance,block,shielding_step,tapetal_step,photons,snr,information_bits_per_deg2_s"
+
+// optimalHeader labels the columns of {species}_optimal.csv.
+const optimalHeader = "log_irradiance,block,shielding_step,tapetal_step,shielding_fraction,tapetal_fraction," +
+	"fwhm_deg,sensitivity_pct,photons,information_bits_per_deg2_s"
+
+// paretoHeader labels the columns of {species}_pareto.csv.
+const paretoHeader = "block,shielding_step,tapetal_step,fwhm_deg,sensitivity_pct"
+
+// informationSteps is the number of steps the information capacity integrates over,
+// from zero to the sampling limit.
+const informationSteps = 200
+
+// informationCapacity returns the information a pigment state can carry, in bits per
+// square degree of visual field per second, given its MTF at informationSteps+1 evenly
+// spaced frequencies from zero to the sampling limit and its signal. Each spatial
+// frequency carries half of log2(1 + (SNR MTF)²) bits, as a Gaussian channel, summed
+// over the disc of frequencies the rhabdom array samples.
+func (m *Model) informationCapacity(transfer []float64, signal visualSignal, integration float64) float64 {
+	step := m.nyquistFrequency() / float64(len(transfer)-1)
+	bits := 0.0
+	for i, t := range transfer {
+		f := float64(i) * step
+		v := 2.0 * math.Pi * f * 0.5 * math.Log2(1.0+math.Pow(signal.SNR*t, 2))
+		if i == 0 || i == len(transfer)-1 {
+			v /= 2.0
+		}
+		bits += v * step
+	}
+	return bits / integration
+}
+
+// diffusePhotonRadiance returns the radiance, in photons/m²/sr/s, of light evenly
+// diffuse over the hemisphere that delivers an irradiance in W/m² within a band.
+func diffusePhotonRadiance(irradiance, bandFrom, bandTo float64) float64 {
+	return photonIrradiance(irradiance, bandFrom, bandTo) / math.Pi
+}
+
+// optimum is the pigment state that carries the most information at a light level.
+type optimum struct {
+	LogIrradiance float64
+	Block         int
+	Signal        visualSignal
+	Information   float64
+}
+
+// optimalStates works out the information capacity of every pigment state at each
+// log10 irradiance, in W/m² within a band, writes them to {species}_information.csv,
+// and returns the state that carries most at each. Ties go to the lower block.
+func (m *Model) optimalStates(summaries []blockSummary, logIrradiances []float64, bandFrom, bandTo float64,
+	noise photonNoise) ([]optimum, error) {
+	// The MTF does not depend on the light, so it is worked out once per state.
+	transfers := make([][]float64, len(summaries))
+	for block, s := range summaries {
+		transfers[block] = make([]float64, informationSteps+1)
+		for i := range transfers[block] {
+			transfers[block][i] = m.mtf(s, float64(i)*m.nyquistFrequency()/informationSteps)
+		}
+	}
+
+	filename := fmt.Sprintf("%s_information.csv", m.Params.SpeciesName)
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+	fmt.Fprintln(writer, informationHeader)
+
+	optima := make([]optimum, len(logIrradiances))
+	for i, l := range logIrradiances {
+		radiance := diffusePhotonRadiance(math.Pow(10, l), bandFrom, bandTo)
+		best := optimum{LogIrradiance: l, Information: -1}
+		for block, s := range summaries {
+			signal := noise.signal(m.extendedCatch(s.SensitivityPercent, radiance))
+			information := m.informationCapacity(transfers[block], signal, noise.Integration)
+			if information > best.Information {
+				best.Block, best.Signal, best.Information = block, signal, information
+			}
+			if _, err := fmt.Fprintf(writer, "%s,%d,%d,%d,%.6g,%.6g,%.6g\n", strconv.FormatFloat(l, 'g', -1, 64),
+				block, block/pigmentSteps, block%pigmentSteps, signal.Photons, signal.SNR, information); err != nil {
+				return nil, fmt.Errorf("writing %s: %w", filename, err)
+			}
+		}
+		optima[i] = best
+	}
+	return optima, writer.Flush()
+}
+
+// writeOptimalStates writes {species}_optimal.csv, the pigment state that carries the
+// most information at each light level.
+func (m *Model) writeOptimalStates(summaries []blockSummary, optima []optimum) error {
+	filename := fmt.Sprintf("%s_optimal.csv", m.Params.SpeciesName)
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, optimalHeader)
+	last := float64(pigmentSteps - 1)
+	for _, o := range optima {
+		s := summaries[o.Block]
+		shielding, tapetal := o.Block/pigmentSteps, o.Block%pigmentSteps
+		if _, err := fmt.Fprintf(writer, "%s,%d,%d,%d,%.4f,%.4f,%s,%s,%.6g,%.6g\n",
+			strconv.FormatFloat(o.LogIrradiance, 'g', -1, 64), o.Block, shielding, tapetal,
+			float64(shielding)/last, float64(tapetal)/last, strconv.FormatFloat(s.FWHMDegrees, 'f', 4, 64),
+			strconv.FormatFloat(s.SensitivityPercent, 'f', 4, 64), o.Signal.Photons, o.Information); err != nil {
+			return fmt.Errorf("writing %s: %w", filename, err)
+		}
+	}
+	return writer.Flush()
+}
+
+// paretoFront returns the blocks no other block beats on both resolution and
+// sensitivity - a narrower or equal acceptance angle with an equal or higher
+// sensitivity, and better on at least one - in order of acceptance angle. Blocks
+// without an acceptance angle are left out.
+func paretoFront(summaries []blockSummary) []int {
+	var front []int
+	for a, sa := range summaries {
+		if math.IsNaN(sa.FWHMDegrees) {
+			continue
+		}
+		dominated := false
+		for b, sb := range summaries {
+			if b == a || math.IsNaN(sb.FWHMDegrees) {
+				continue
+			}
+			if sb.FWHMDegrees <= sa.FWHMDegrees && sb.SensitivityPercent >= sa.SensitivityPercent &&
+				(sb.FWHMDegrees < sa.FWHMDegrees || sb.SensitivityPercent > sa.SensitivityPercent) {
+				dominated = true
+				break
+			}
+		}
+		if !dominated {
+			front = append(front, a)
+		}
+	}
+	sort.SliceStable(front, func(i, j int) bool {
+		return summaries[front[i]].FWHMDegrees < summaries[front[j]].FWHMDegrees
+	})
+	return front
+}
+
+// writeParetoFront writes {species}_pareto.csv, the blocks of the Pareto front of
+// resolution against sensitivity.
+func (m *Model) writeParetoFront(summaries []blockSummary, front []int) error {
+	filename := fmt.Sprintf("%s_pareto.csv", m.Params.SpeciesName)
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, paretoHeader)
+	for _, block := range front {
+		s := summaries[block]
+		if _, err := fmt.Fprintf(writer, "%d,%d,%d,%.4f,%.4f\n", block, block/pigmentSteps, block%pigmentSteps,
+			s.FWHMDegrees, s.SensitivityPercent); err != nil {
+			return fmt.Errorf("writing %s: %w", filename, err)
+		}
+	}
+	return writer.Flush()
+}
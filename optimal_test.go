@@ -0,0 +1,84 @@
+// FILE: optimal_test.go
+// This file contains tests for the search for the best pigment state in optimal.go
+
+package main
+
+import (
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestInformationCapacity checks the integral against its closed form for a perfect
+// MTF, and that no signal carries no information.
+func TestInformationCapacity(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_information"))
+	transfer := make([]float64, informationSteps+1)
+	for i := range transfer {
+		transfer[i] = 1
+	}
+	nyquist := model.nyquistFrequency()
+	want := math.Pi / 2 * nyquist * nyquist * math.Log2(1+100) / 0.1
+	if got := model.informationCapacity(transfer, visualSignal{SNR: 10}, 0.1); math.Abs(got-want) > 1e-9*want {
+		t.Errorf("Expected %g bits/deg²/s, got %g", want, got)
+	}
+	if got := model.informationCapacity(transfer, visualSignal{}, 0.1); got != 0 {
+		t.Errorf("Expected no information without a signal, got %g", got)
+	}
+}
+
+func TestParetoFront(t *testing.T) {
+	summaries := []blockSummary{
+		{FWHMDegrees: 10, SensitivityPercent: 50},
+		{FWHMDegrees: 12, SensitivityPercent: 60},
+		{FWHMDegrees: 12, SensitivityPercent: 55},
+		{FWHMDegrees: 8, SensitivityPercent: 40},
+		{FWHMDegrees: math.NaN(), SensitivityPercent: 90},
+		{FWHMDegrees: 10, SensitivityPercent: 50},
+	}
+	if got, want := paretoFront(summaries), []int{3, 0, 5, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the front %v, got %v", want, got)
+	}
+}
+
+// TestOptimalStates checks that the state chosen at each light level carries at least
+// as much information as any other, and that every state is written at every level.
+func TestOptimalStates(t *testing.T) {
+	t.Chdir(t.TempDir())
+	model := mustModel(t, nephropsFlatLateral("test_optimal"))
+	summaries := model.simulate(nil)
+	noise := photonNoise{Integration: 0.1, Reliability: 1}
+	levels := []float64{-5, 0}
+	optima, err := model.optimalStates(summaries, levels, 400, 700, noise)
+	if err != nil {
+		t.Fatalf("optimalStates returned an unexpected error: %v", err)
+	}
+
+	for i, o := range optima {
+		radiance := diffusePhotonRadiance(math.Pow(10, levels[i]), 400, 700)
+		for block, s := range summaries {
+			transfer := make([]float64, informationSteps+1)
+			for k := range transfer {
+				transfer[k] = model.mtf(s, float64(k)*model.nyquistFrequency()/informationSteps)
+			}
+			signal := noise.signal(model.extendedCatch(s.SensitivityPercent, radiance))
+			if info := model.informationCapacity(transfer, signal, noise.Integration); info > o.Information {
+				t.Errorf("At 10^%g W/m²: block %d carries %g bits, more than the chosen block %d's %g",
+					levels[i], block, info, o.Block, o.Information)
+			}
+		}
+	}
+	if !(optima[1].Information > optima[0].Information) {
+		t.Errorf("Expected more light to carry more information, got %g then %g", optima[0].Information, optima[1].Information)
+	}
+
+	data, err := os.ReadFile("test_optimal_information.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1+len(levels)*len(summaries) {
+		t.Errorf("Expected %d rows, got %d", len(levels)*len(summaries), len(lines)-1)
+	}
+}
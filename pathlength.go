@@ -4,27 +4,18 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const version = "0.6.0"
 
-func main() {
-	// --- Command Line Argument Parsing ---
-	paramFile := flag.String("f", "", "Path to a parameter file (CSV format). (Required)")
-	debugFlag := flag.Bool("d", false, "Generate debug CSV output file.")
-	showCitation := flag.Bool("c", false, "Show the program citation.")
-	showHelp := flag.Bool("h", false, "Show this help message.")
-	showLicense := flag.Bool("l", false, "Show the program license.")
-	showVersion := flag.Bool("v", false, "Show program version.")
-	flag.Parse()
-
-	if *showLicense {
-		fmt.Println(`pathlength - calculates resolution and sensitivity in reflective superposition compound eyes.
+const licenseText = `pathlength - calculates resolution and sensitivity in reflective superposition compound eyes.
 
 Copyright (C) 2020 Dr Stephen P Moss
 
@@ -39,77 +30,160 @@ MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
 GNU General Public License for more details.
 
 You should have received a copy of the GNU General Public License
-along with this program.  If not, see <https://www.gnu.org/licenses/>`)
-		os.Exit(0)
-	}
+along with this program.  If not, see <https://www.gnu.org/licenses/>`
 
-	if *showCitation {
-		fmt.Println(`Gaten, E., Moss, S., Johnson, M. 2013. The Reniform Reflecting Superposition Compound Eyes of Nephrops Norvegicus:
+const citationText = `Gaten, E., Moss, S., Johnson, M. 2013. The Reniform Reflecting Superposition Compound Eyes of Nephrops Norvegicus:
 Optics, Susceptibility to Light-Induced Damage, Electrophysiology and a Ray Tracing Model. In: M. L. Johnson and M. P. Johnson, ed(s).
-Advances in Marine Biology: The Ecology and Biology of Nephrops norvegicus. Oxford: Academic Press, 107:148.`)
-		os.Exit(0)
-	}
+Advances in Marine Biology: The Ecology and Biology of Nephrops norvegicus. Oxford: Academic Press, 107:148.`
+
+// command is one subcommand of the program. Each parses its own flags, so new
+// capabilities get their own namespace rather than another single-letter switch.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(fs *flag.FlagSet, args []string) error
+}
 
-	if *showHelp {
-		fmt.Printf("Usage: %s -f filename [-c] [-d] [-h] [-l] [-v]\n", filepath.Base(os.Args[0]))
-		flag.PrintDefaults()
-		os.Exit(0)
-	}
+var commands = []command{
+	{"run", "-f filename [-strict] [-d] [-legacy] [-compat] [-depth-bin um]", "Simulate every parameter set in a file and write the results.", runCommand},
+	{"validate", "-f filename [-strict]", "Check a parameter file without running any simulation.", validateCommand},
+	{"sweep", "-f filename [-strict] -param name -from value -to value [-steps n] [-species name]",
+		"Rerun the model while stepping one parameter across a range.", sweepCommand},
+	{"rays", "-f filename [-strict] -species name [-block n]",
+		"Draw every facet's ray through the rhabdom array for one pigment state.", raysCommand},
+	{"animate", "-f filename [-strict] -species name [-path spec] [-delay n]",
+		"Animate the point spread function as the pigments migrate.", animateCommand},
+	{"convert", "-f filename [-strict] [-species name] [-o prefix] legacyfile",
+		"Convert a pathlengths file from an earlier release and recompute its summaries.", convertCommand},
+	{"compare", "[-f filename [-strict]] [-res-abs deg] [-res-rel fraction] [-sen-abs pct] [-sen-rel fraction] [-o prefix] A B",
+		"Compare two result sets and check them against tolerances.", compareCommand},
+	{"adapt", "-f filename [-strict] -species name [-from n -to n -steps n] [-shielding sigmoid] [-tapetal sigmoid] [-interpolate]",
+		"Follow resolution and sensitivity across light levels as the pigments adapt.", adaptCommand},
+	{"diel", "-f filename [-strict] -species name [-light file | -surface n -depth m -attenuation c -sunrise h -sunset h -night n] " +
+		"[-shielding sigmoid] [-tapetal sigmoid] [-shielding-tau light,dark] [-tapetal-tau light,dark] [-hours h] [-step min] " +
+		"[-band-from nm -band-to nm] [-interpolate] [-o file]",
+		"Follow resolution, sensitivity and photon catch through a day as the pigments migrate.", dielCommand},
+	{"catch", "-f filename [-strict] -species name [-water type | -attenuation file] [-depth m] [-radiance n] [-band-from nm -band-to nm]",
+		"Work out the photons each pigment state absorbs from the light at a depth.", catchCommand},
+	{"detect", "-f filename [-strict] -species name [-source photons] [-attenuation c] [-threshold photons] [-integration s] [-o file]",
+		"Work out how far away each pigment state can see a bioluminescent flash.", detectCommand},
+	{"contrast", "-f filename [-strict] -species name [-water type | -attenuation file] [-depth m] [-radiance n] " +
+		"[-band-from nm -band-to nm] [-integration s] [-dark rate] [-reliability sd] [-max-frequency cpd] [-frequencies n]",
+		"Work out the photon noise and contrast sensitivity of each pigment state at a depth.", contrastCommand},
+	{"optimal", "-f filename [-strict] -species name [-from n -to n -steps n] [-band-from nm -band-to nm] [-integration s] [-dark rate]",
+		"Find the pigment state that carries the most information at each light level.", optimalCommand},
+	{"damage", "-f filename [-strict] -species name -regime file [-thresholds list] [-depth-bin um] [-o file]",
+		"Accumulate the photons absorbed along the rhabdom over a light exposure regime.", damageCommand},
+	{"verify", "[manifest]", "Check a run's outputs against the checksums in its manifest.", verifyCommand},
+	{"info", "[-citation] [-license] [-constants]", "Show the citation, license and model constants.", infoCommand},
+	{"version", "", "Show the program version.", versionCommand},
+}
 
-	if *showVersion {
-		fmt.Printf("%s version %s\n", filepath.Base(os.Args[0]), version)
-		os.Exit(0)
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
 	}
+	return command{}, false
+}
 
-	// --- Initialisation ---
-	// Exit if no parameter file is provided.
-	if *paramFile == "" {
-		fmt.Printf("Usage: %s -f filename [-c] [-d] [-h] [-l] [-v]\n", filepath.Base(os.Args[0]))
-		flag.PrintDefaults()
-		log.Fatal("Error: No parameter file supplied. Use the -f flag to specify a file.")
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s <command> [flags]\n\nCommands:\n", programName())
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-9s %s\n", c.name, c.summary)
 	}
+	fmt.Fprintf(out, "\nRun '%s help <command>' for the flags of a command.\n", programName())
+	fmt.Fprintf(out, "'%s -f filename' is shorthand for '%s run -f filename'.\n", programName(), programName())
+}
 
-	fmt.Printf("Parsing input parameters from %s...\n", *paramFile)
-	paramsList, err := parseInputParameters(*paramFile)
-	if err != nil {
-		log.Fatalf("Error parsing parameter file: %v", err)
+// newFlagSet returns a flag set for a subcommand whose usage message names the
+// subcommand and its arguments.
+func newFlagSet(c command) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s\n\n", programName(), c.name, c.args, c.summary)
+		fs.PrintDefaults()
 	}
+	return fs
+}
 
-	// --- Loop over each parameter set and run the model ---
-	failed := 0
-	for _, params := range paramsList {
-		model, err := NewModel(params)
-		if err != nil {
-			log.Printf("Skipping %s: %v", params.SpeciesName, err)
-			failed++
-			continue
-		}
-		model.DebugMode = *debugFlag
+// legacyArgs translates the flat flag set of earlier releases into a subcommand, so
+// that scripts written against `pathlength -f file` keep working.
+func legacyArgs(args []string) ([]string, error) {
+	fs := flag.NewFlagSet(programName(), flag.ContinueOnError)
+	fs.Usage = printUsage
+	paramFile := fs.String("f", "", "Path to a parameter file (CSV format).")
+	debugFlag := fs.Bool("d", false, "Generate debug CSV output file.")
+	showCitation := fs.Bool("c", false, "Show the program citation.")
+	showLicense := fs.Bool("l", false, "Show the program license.")
+	showVersion := fs.Bool("v", false, "Show program version.")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
 
-		fmt.Printf("--- Running simulation for %s ---\n", model.Params.SpeciesName)
-		fmt.Printf("%d facets across the eyeshine patch, ommatidial angle %.4f deg, critical angle %.4f deg\n",
-			model.NumberOfFacets, model.OmmatidialAngle, model.CriticalAngle)
+	switch {
+	case *showLicense:
+		return []string{"info", "-license"}, nil
+	case *showCitation:
+		return []string{"info", "-citation"}, nil
+	case *showVersion:
+		return []string{"version"}, nil
+	}
+	translated := []string{"run", "-f", *paramFile}
+	if *debugFlag {
+		translated = append(translated, "-d")
+	}
+	return append(translated, fs.Args()...), nil
+}
 
-		// --- Run Simulation & Calculate Results ---
-		fmt.Printf("Calculating pathlengths for %s...\n", model.Params.SpeciesName)
-		summaries, err := model.runModel()
+// dispatch runs the subcommand named by the first argument.
+func dispatch(args []string) error {
+	if len(args) == 0 {
+		printUsage()
+		return errors.New("no command supplied")
+	}
+	if strings.HasPrefix(args[0], "-") {
+		translated, err := legacyArgs(args)
 		if err != nil {
-			log.Printf("Simulation for %s failed: %v", model.Params.SpeciesName, err)
-			failed++
-			continue
+			return err
 		}
+		args = translated
+	}
 
-		if err := model.calculateRessens(summaries); err != nil {
-			log.Printf("Summary for %s failed: %v", model.Params.SpeciesName, err)
-			failed++
-			continue
+	if args[0] == "help" {
+		if len(args) > 1 {
+			if c, ok := findCommand(args[1]); ok {
+				// Commands declare their flags as they run, so ask the command
+				// itself for its help rather than printing an empty flag set.
+				return c.run(newFlagSet(c), []string{"-h"})
+			}
+			printUsage()
+			return fmt.Errorf("unknown command %q", args[1])
 		}
+		printUsage()
+		return nil
+	}
 
-		fmt.Printf("--- Finished simulation for %s ---\n\n", model.Params.SpeciesName)
+	c, ok := findCommand(args[0])
+	if !ok {
+		printUsage()
+		return fmt.Errorf("unknown command %q", args[0])
 	}
+	return c.run(newFlagSet(c), args[1:])
+}
 
-	if failed > 0 {
-		log.Fatalf("%d of %d parameter sets could not be simulated.", failed, len(paramsList))
+func main() {
+	if err := dispatch(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatalf("Error: %v", err)
 	}
-	fmt.Println("All simulations complete.")
 }
@@ -0,0 +1,76 @@
+// FILE: pathlength_test.go
+// This file contains tests for the command line dispatch in pathlength.go
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestLegacyArgs checks that the flat flag set of earlier releases still selects the
+// equivalent subcommand, so existing scripts keep working.
+func TestLegacyArgs(t *testing.T) {
+	cases := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"-f", "params.csv"}, []string{"run", "-f", "params.csv"}},
+		{[]string{"-f", "params.csv", "-d"}, []string{"run", "-f", "params.csv", "-d"}},
+		{[]string{"-c"}, []string{"info", "-citation"}},
+		{[]string{"-l"}, []string{"info", "-license"}},
+		{[]string{"-v"}, []string{"version"}},
+	}
+	for _, tc := range cases {
+		got, err := legacyArgs(tc.args)
+		if err != nil {
+			t.Errorf("legacyArgs(%v) returned an unexpected error: %v", tc.args, err)
+			continue
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("legacyArgs(%v) = %v, expected %v", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	flag.CommandLine.SetOutput(io.Discard)
+	defer flag.CommandLine.SetOutput(nil)
+
+	if err := dispatch(nil); err == nil {
+		t.Error("Expected an error when no command is supplied")
+	}
+	if err := dispatch([]string{"frobnicate"}); err == nil {
+		t.Error("Expected an error for an unknown command")
+	}
+	if err := dispatch([]string{"run"}); !errors.Is(err, errNoParameterFile) {
+		t.Errorf("Expected run without -f to report a missing parameter file, got %v", err)
+	}
+	for _, c := range commands {
+		fs := newFlagSet(c)
+		fs.SetOutput(io.Discard)
+		if err := c.run(fs, []string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("Expected '%s -h' to print its help, got %v", c.name, err)
+		}
+	}
+}
+
+// TestCommandUsage checks that every command's usage line names each flag it
+// registers, so the table stays in step with the commands.
+func TestCommandUsage(t *testing.T) {
+	for _, c := range commands {
+		fs := newFlagSet(c)
+		fs.SetOutput(io.Discard)
+		c.run(fs, []string{"-h"})
+		named := strings.FieldsFunc(c.args, func(r rune) bool { return strings.ContainsRune(" []|/", r) })
+		fs.VisitAll(func(f *flag.Flag) {
+			if !slices.Contains(named, "-"+f.Name) {
+				t.Errorf("%s: usage %q does not name -%s", c.name, c.args, f.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// FILE: raydiagram.go
+// This file contains the SVG ray path diagrams, which draw every facet's ray through
+// the rhabdom array for one pigment state.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// caseColours gives each terminal case of the trace its own colour in the diagrams.
+var caseColours = []struct {
+	Case        string
+	Colour      string
+	Description string
+}{
+	{"C1", "#d62728", "C1: crossed rhabdoms until the pigment stopped it"},
+	{"C2", "#1f77b4", "C2: reflected at the rhabdom wall"},
+	{"C3", "#2ca02c", "C3: reached the base without meeting the wall"},
+	{"C4", "#9467bd", "C4: axial ray"},
+	{"lost", "#7f7f7f", "lost: turned 90 degrees or more to the axis"},
+}
+
+func caseColour(terminalCase string) string {
+	for _, c := range caseColours {
+		if c.Case == terminalCase {
+			return c.Colour
+		}
+	}
+	return "black"
+}
+
+// Ray diagram layout, in SVG user units.
+const (
+	rayDiagramWidth  = 900
+	rayDiagramHeight = 560
+	rayDiagramLeft   = 110
+	rayDiagramTop    = 60
+	rayDiagramRight  = 110
+	rayDiagramBottom = 150
+)
+
+// zigzag returns the points a ray passes through between two depths, reflecting off
+// the rhabdom walls at +/- radius. The lateral position x and direction dir are
+// updated in place so the next leg continues from where this one ends.
+func zigzag(x, dir *float64, start, end, angle, radius float64) [][2]float64 {
+	points := [][2]float64{{*x, start}}
+	tan := math.Tan(angle * degToRadConv)
+	step := 1.0
+	if end < start {
+		step = -1.0
+	}
+	depth := start
+	remaining := math.Abs(end - start)
+	// A wall-to-wall traverse covers 2r/tan of depth, so this bounds the loop even
+	// for steep rays.
+	for remaining > 1e-9 && tan > 0 {
+		toWall := radius - *x*(*dir)
+		if toWall <= 1e-9 {
+			// Already at the wall this leg is heading for: reflect off it.
+			*dir = -*dir
+			continue
+		}
+		d := math.Min(remaining, toWall/tan)
+		*x += *dir * d * tan
+		depth += step * d
+		remaining -= d
+		points = append(points, [2]float64{*x, depth})
+		if remaining > 1e-9 {
+			*dir = -*dir
+		}
+	}
+	if tan <= 0 {
+		points = append(points, [2]float64{*x, end})
+	}
+	return points
+}
+
+// renderRayDiagram draws the rhabdom array for one pigment state: each rhabdom with
+// its tapered tip, the extent of the shielding and tapetal pigments, and every
+// facet's ray leg by leg, coloured by the case that ended its trace.
+//
+// Each facet's ray starts on the axis of the rhabdom its image is displaced onto by
+// the blur circle. The model treats every rhabdom a ray enters as a fresh traverse
+// from that rhabdom's axis, so where a ray crosses into the next rhabdom the diagram
+// joins the two legs with a dotted line rather than inventing a path between them.
+func (m *Model) renderRayDiagram(w io.Writer, block int) error {
+	if block < 0 || block >= pigmentSteps*pigmentSteps {
+		return fmt.Errorf("block %d is out of range 0-%d", block, pigmentSteps*pigmentSteps-1)
+	}
+	p := m.Params
+	shielding, tapetal := m.pigmentPositions(block)
+
+	traces := make([]traceResult, m.NumberOfFacets)
+	rhabdoms := 1
+	for facet := range traces {
+		traces[facet] = m.traceRay(facet, shielding, tapetal)
+		reach := int(math.Floor(m.blurOffset(facet))) + len(traces[facet].Pathlengths)
+		if reach > rhabdoms {
+			rhabdoms = reach
+		}
+	}
+
+	// One scale on both axes, so the ray angles are drawn true.
+	scale := math.Min(float64(rayDiagramWidth)/(float64(rhabdoms)*p.RhabdomWidth),
+		float64(rayDiagramHeight)/p.RhabdomLength)
+	arrayWidth := float64(rhabdoms) * p.RhabdomWidth * scale
+	arrayHeight := p.RhabdomLength * scale
+	width := rayDiagramLeft + int(math.Ceil(arrayWidth)) + rayDiagramRight
+	height := rayDiagramTop + int(math.Ceil(arrayHeight)) + rayDiagramBottom
+	left, top := float64(rayDiagramLeft), float64(rayDiagramTop)
+	px := func(rhabdom int, lateral float64) float64 {
+		return left + ((float64(rhabdom)+0.5)*p.RhabdomWidth+lateral)*scale
+	}
+	py := func(depth float64) float64 { return top + depth*scale }
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(bw, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+	fmt.Fprintf(bw, `<text x="%.1f" y="%d" font-size="15" text-anchor="middle">%s: block %d (shielding %.1f µm, tapetal %.1f µm)</text>`+"\n",
+		left+arrayWidth/2, rayDiagramTop-30, svgText(p.SpeciesName), block, shielding, tapetal)
+
+	// Pigment extents, measured from the proximal end of the rhabdom.
+	for _, pigment := range []struct {
+		name   string
+		extent float64
+		colour string
+		barX   float64
+	}{
+		{"Shielding", shielding, "#8c564b", left - 40},
+		{"Tapetal", tapetal, "#e6b800", left + arrayWidth + 24},
+	} {
+		if pigment.extent <= 0 {
+			continue
+		}
+		y0, y1 := py(p.RhabdomLength-pigment.extent), py(p.RhabdomLength)
+		fmt.Fprintf(bw, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" fill-opacity="0.2"/>`+"\n",
+			left, y0, arrayWidth, y1-y0, pigment.colour)
+		fmt.Fprintf(bw, `<rect x="%.1f" y="%.1f" width="16" height="%.1f" fill="%s"/>`+"\n",
+			pigment.barX, y0, y1-y0, pigment.colour)
+		fmt.Fprintf(bw, `<text transform="translate(%.1f,%.1f) rotate(-90)" text-anchor="middle">%s pigment</text>`+"\n",
+			pigment.barX-4, (y0+y1)/2, pigment.name)
+	}
+
+	// Rhabdoms, with the distal tip tapered by the proximal rhabdom angle: the wall
+	// of the taper leans by that angle, over the depth it takes to reach full width.
+	r := m.RhabdomRadius
+	tip := 0.0
+	if p.ProximalRhabdomAngle > 0 {
+		tip = math.Min(r/math.Tan(p.ProximalRhabdomAngle*degToRadConv), p.RhabdomLength/3)
+	}
+	for j := 0; j < rhabdoms; j++ {
+		var pts []string
+		if tip > 0 {
+			pts = []string{
+				fmt.Sprintf("%.1f,%.1f", px(j, 0), py(0)),
+				fmt.Sprintf("%.1f,%.1f", px(j, r), py(tip)),
+				fmt.Sprintf("%.1f,%.1f", px(j, r), py(p.RhabdomLength)),
+				fmt.Sprintf("%.1f,%.1f", px(j, -r), py(p.RhabdomLength)),
+				fmt.Sprintf("%.1f,%.1f", px(j, -r), py(tip)),
+			}
+		} else {
+			pts = []string{
+				fmt.Sprintf("%.1f,%.1f", px(j, -r), py(0)),
+				fmt.Sprintf("%.1f,%.1f", px(j, r), py(0)),
+				fmt.Sprintf("%.1f,%.1f", px(j, r), py(p.RhabdomLength)),
+				fmt.Sprintf("%.1f,%.1f", px(j, -r), py(p.RhabdomLength)),
+			}
+		}
+		fmt.Fprintf(bw, `<polygon points="%s" fill="#f4dbe6" fill-opacity="0.7" stroke="#a0527a" stroke-width="0.8"/>`+"\n",
+			strings.Join(pts, " "))
+	}
+
+	// Rays.
+	for facet, trace := range traces {
+		colour := caseColour(trace.TerminalCase)
+		base := int(math.Floor(m.blurOffset(facet)))
+		fmt.Fprintf(bw, `<g stroke="%s" fill="none" stroke-width="1.2"><title>facet %d: %s, %d rhabdoms</title>`+"\n",
+			colour, facet, trace.TerminalCase, len(trace.Pathlengths))
+		if len(trace.Segments) == 0 {
+			// A ray lost before it entered anything is marked where it arrived.
+			fmt.Fprintf(bw, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`+"\n", px(base, 0), py(0), colour)
+		}
+		x, dir := 0.0, 1.0
+		current := -1
+		var last [2]float64
+		for _, seg := range trace.Segments {
+			if seg.Rhabdom != current {
+				if current >= 0 {
+					fmt.Fprintf(bw, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke-dasharray="1,2"/>`+"\n",
+						px(base+current, last[0]), py(last[1]), px(base+seg.Rhabdom, 0), py(seg.StartDepth))
+				}
+				current = seg.Rhabdom
+				x, dir = 0, 1
+			}
+			points := zigzag(&x, &dir, seg.StartDepth, seg.EndDepth, seg.Angle, r)
+			coords := make([]string, len(points))
+			for i, pt := range points {
+				coords[i] = fmt.Sprintf("%.1f,%.1f", px(base+current, pt[0]), py(pt[1]))
+			}
+			dash := ""
+			if seg.Kind == segmentReturn {
+				dash = ` stroke-dasharray="4,3"`
+			}
+			fmt.Fprintf(bw, `<polyline points="%s"%s/>`+"\n", strings.Join(coords, " "), dash)
+			last = points[len(points)-1]
+		}
+		fmt.Fprintln(bw, `</g>`)
+	}
+
+	// Depth axis.
+	fmt.Fprintf(bw, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="black"/>`+"\n",
+		left-60, py(0), left-60, py(p.RhabdomLength))
+	for k := 0; k <= 4; k++ {
+		depth := p.RhabdomLength * float64(k) / 4
+		fmt.Fprintf(bw, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="black"/><text x="%.1f" y="%.1f" text-anchor="end">%.4g</text>`+"\n",
+			left-64, py(depth), left-60, py(depth), left-68, py(depth)+4, depth)
+	}
+	fmt.Fprintf(bw, `<text transform="translate(%.1f,%.1f) rotate(-90)" text-anchor="middle">Depth from distal tip (µm)</text>`+"\n",
+		left-96, py(p.RhabdomLength/2))
+
+	// Legend.
+	y := top + arrayHeight + 30
+	for i, c := range caseColours {
+		fmt.Fprintf(bw, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="2"/><text x="%.1f" y="%.1f">%s</text>`+"\n",
+			left, y+float64(i)*16, left+24, y+float64(i)*16, c.Colour, left+30, y+float64(i)*16+4, svgText(c.Description))
+	}
+	y += float64(len(caseColours)) * 16
+	fmt.Fprintf(bw, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="black" stroke-dasharray="4,3"/><text x="%.1f" y="%.1f">returning after reflection off the tapetum; dotted: crossing into the next rhabdom</text>`+"\n",
+		left, y, left+24, y, left+30, y+4)
+
+	fmt.Fprintln(bw, `</svg>`)
+	return bw.Flush()
+}
+
+// writeRayDiagram writes {species}_rays_block{N}.svg for the given pigment block.
+func (m *Model) writeRayDiagram(block int) (string, error) {
+	filename := fmt.Sprintf("%s_rays_block%d.svg", m.Params.SpeciesName, block)
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", fmt.Errorf("creating %s: %w", filename, err)
+	}
+	if err := m.renderRayDiagram(file, block); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("writing %s: %w", filename, err)
+	}
+	return filename, nil
+}
@@ -0,0 +1,90 @@
+// FILE: raydiagram_test.go
+// This file contains tests for the ray path diagrams in raydiagram.go
+
+package main
+
+import (
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestZigzagStaysInsideTheRhabdom checks that a reflected leg bounces between the
+// walls without leaving the rhabdom and covers exactly the depth it was given.
+func TestZigzagStaysInsideTheRhabdom(t *testing.T) {
+	x, dir := 0.0, 1.0
+	points := zigzag(&x, &dir, 0, 100, 45, 10)
+	// A 45 degree ray first meets the wall 10 um down, then crosses the full 20 um
+	// width every 20 um of depth: walls at 10, 30, 50, 70 and 90 um.
+	if len(points) != 7 {
+		t.Fatalf("Expected 7 points, got %d: %v", len(points), points)
+	}
+	for _, pt := range points {
+		if math.Abs(pt[0]) > 10+1e-9 {
+			t.Errorf("Point %v lies outside the rhabdom", pt)
+		}
+	}
+	if end := points[len(points)-1]; math.Abs(end[1]-100) > 1e-9 || math.Abs(end[0]-x) > 1e-9 {
+		t.Errorf("Expected the leg to end at depth 100 at x=%f, got %v", x, end)
+	}
+
+	// A return leg runs back up towards the tip.
+	back := zigzag(&x, &dir, 100, 0, 45, 10)
+	if end := back[len(back)-1]; math.Abs(end[1]) > 1e-9 {
+		t.Errorf("Expected the return leg to end at the tip, got %v", end)
+	}
+
+	// An axial ray never meets the wall.
+	x, dir = 0, 1
+	if axial := zigzag(&x, &dir, 0, 50, 0, 10); len(axial) != 2 || axial[1] != [2]float64{0, 50} {
+		t.Errorf("Expected a straight axial leg, got %v", axial)
+	}
+}
+
+func TestRenderRayDiagram(t *testing.T) {
+	params := nephropsFlatLateral("test_rays")
+	params.ProximalRhabdomAngle = 12.5
+	model := mustModel(t, params)
+
+	var out strings.Builder
+	if err := model.renderRayDiagram(&out, 56); err != nil {
+		t.Fatalf("renderRayDiagram returned an unexpected error: %v", err)
+	}
+	svg := out.String()
+	wellFormedXML(t, svg)
+	if n := strings.Count(svg, "<title>facet "); n != model.NumberOfFacets {
+		t.Errorf("Expected one ray per facet (%d), got %d", model.NumberOfFacets, n)
+	}
+	for _, want := range []string{"Shielding pigment", "Tapetal pigment", "block 56 (shielding 90.0 µm, tapetal 18.0 µm)"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("Expected the diagram to contain %q", want)
+		}
+	}
+
+	if err := model.renderRayDiagram(&out, pigmentSteps*pigmentSteps); err == nil {
+		t.Error("Expected an error for a block beyond the last pigment state")
+	}
+}
+
+// TestRaysRejectsBlockOutOfRange checks that a block off the pigment grid is refused
+// before any diagram file is created.
+func TestRaysRejectsBlockOutOfRange(t *testing.T) {
+	paramFile, err := filepath.Abs("example_data/nephrops_parameters.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	for _, block := range []string{"-1", "121"} {
+		err := raysCommand(flag.NewFlagSet("rays", flag.ContinueOnError),
+			[]string{"-f", paramFile, "-species", "nephropsfl", "-block", block})
+		if err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("Block %s: expected it to be refused, got %v", block, err)
+		}
+		if _, err := os.Stat("nephropsfl_rays_block" + block + ".svg"); !os.IsNotExist(err) {
+			t.Errorf("Block %s: expected no diagram, got %v", block, err)
+		}
+	}
+}
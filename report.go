@@ -0,0 +1,388 @@
+// FILE: report.go
+// This file contains the self-contained HTML report written for each run.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// reportRow is one labelled value in a report table.
+type reportRow struct {
+	Label, Value string
+}
+
+// reportSpecies holds everything the report shows for one simulated species.
+type reportSpecies struct {
+	Name       string
+	Parameters []reportRow
+	Geometry   []reportRow
+	// The heatmaps are embedded as data URIs, so the page needs no other files.
+	ResolutionHeatmap  template.URL
+	SensitivityHeatmap template.URL
+	// The line and bar charts are inline SVG.
+	AngularSensitivity template.HTML
+	CaseHistogram      template.HTML
+	Warnings           []string
+}
+
+// reportComparison is one species' row of the cross-species table.
+type reportComparison struct {
+	Name                                 string
+	Facets                               int
+	OmmatidialAngle                      string
+	DarkRes, DarkSen, LightRes, LightSen string
+	MinRes, MaxSen                       string
+}
+
+// reportData is the whole report, as passed to the template.
+type reportData struct {
+	Version       string
+	Generated     string
+	ParameterFile string
+	Comparison    []reportComparison
+	Species       []reportSpecies
+	// Skipped lists the parameter sets that could not be simulated, and why.
+	Skipped []string
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>pathlength report: {{.ParameterFile}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 1100px; color: #222; }
+h1, h2, h3 { font-weight: normal; }
+h2 { border-bottom: 1px solid #ccc; padding-bottom: 0.2em; margin-top: 2em; }
+table { border-collapse: collapse; margin: 0.5em 0 1em; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.6em; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+th { background: #f2f2f2; }
+.tables { display: flex; gap: 2em; flex-wrap: wrap; }
+.figures img, .figures svg { max-width: 100%; height: auto; }
+.warning { background: #fff4ce; border-left: 4px solid #e0a800; padding: 0.4em 0.8em; margin: 0.3em 0; }
+.meta { color: #666; }
+</style>
+</head>
+<body>
+<h1>pathlength report</h1>
+<p class="meta">Parameter file {{.ParameterFile}}, pathlength {{.Version}}, generated {{.Generated}}.</p>
+{{range .Skipped}}<p class="warning">{{.}}</p>
+{{end}}
+<h2>Comparison across species</h2>
+<p>Dark-adapted is the state with both pigments fully retracted (block 0); light-adapted has
+both fully extended (the last block).</p>
+<table>
+<tr><th>Species</th><th>Facets</th><th>Ommatidial angle (deg)</th><th>Dark res (deg)</th><th>Dark sen (%)</th><th>Light res (deg)</th><th>Light sen (%)</th><th>Finest res (deg)</th><th>Highest sen (%)</th></tr>
+{{range .Comparison}}<tr><td><a href="#{{.Name}}">{{.Name}}</a></td><td>{{.Facets}}</td><td>{{.OmmatidialAngle}}</td><td>{{.DarkRes}}</td><td>{{.DarkSen}}</td><td>{{.LightRes}}</td><td>{{.LightSen}}</td><td>{{.MinRes}}</td><td>{{.MaxSen}}</td></tr>
+{{end}}</table>
+{{range .Species}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+{{range .Warnings}}<p class="warning">{{.}}</p>
+{{end}}<div class="tables">
+<table>
+<tr><th colspan="2">Input parameters</th></tr>
+{{range .Parameters}}<tr><td>{{.Label}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+<table>
+<tr><th colspan="2">Derived geometry</th></tr>
+{{range .Geometry}}<tr><td>{{.Label}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+</div>
+<div class="figures">
+<h3>Resolution and sensitivity</h3>
+<img src="{{.ResolutionHeatmap}}" alt="Resolution heatmap for {{.Name}}">
+<img src="{{.SensitivityHeatmap}}" alt="Sensitivity heatmap for {{.Name}}">
+<h3>Angular sensitivity</h3>
+{{.AngularSensitivity}}
+<h3>Terminal cases</h3>
+{{.CaseHistogram}}
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+// svgDataURI renders an SVG into a data URI that can stand in for an image file.
+func svgDataURI(render func(w io.Writer) error) (template.URL, error) {
+	var buf bytes.Buffer
+	if err := render(&buf); err != nil {
+		return "", err
+	}
+	return template.URL("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// Angular sensitivity plot layout, in SVG user units.
+const (
+	asfWidth  = 640
+	asfHeight = 300
+	asfLeft   = 60
+	asfRight  = 150
+	asfTop    = 30
+	asfBottom = 50
+)
+
+// angularCurve is one angular sensitivity function to be plotted.
+type angularCurve struct {
+	Label  string
+	Colour string
+	// PSF is the light per unit area at each rhabdom offset, as in blockSummary.
+	PSF []float64
+}
+
+// renderAngularSensitivity plots angular sensitivity functions against the angle from
+// the optic axis. Each curve is normalised to its own peak, and mirrored about the
+// axis since each rhabdom offset stands for both sides of it. The dashed line marks
+// half maximum, where the acceptance angle is read.
+func renderAngularSensitivity(w io.Writer, curves []angularCurve, ommatidialAngle float64) error {
+	extent := 1
+	for _, c := range curves {
+		if len(c.PSF) > extent {
+			extent = len(c.PSF)
+		}
+	}
+	maxAngle := float64(extent) * ommatidialAngle
+	plotW := float64(asfWidth - asfLeft - asfRight)
+	plotH := float64(asfHeight - asfTop - asfBottom)
+	px := func(angle float64) float64 { return asfLeft + (angle+maxAngle)/(2*maxAngle)*plotW }
+	py := func(v float64) float64 { return asfTop + (1-v)*plotH }
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		asfWidth, asfHeight, asfWidth, asfHeight)
+	fmt.Fprintf(bw, `<rect width="%d" height="%d" fill="white"/>`+"\n", asfWidth, asfHeight)
+	fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%.1f" height="%.1f" fill="none" stroke="black"/>`+"\n",
+		asfLeft, asfTop, plotW, plotH)
+	fmt.Fprintf(bw, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#888" stroke-dasharray="4 3"/>`+"\n",
+		asfLeft, py(0.5), asfLeft+plotW, py(0.5))
+
+	for k := 0; k <= 4; k++ {
+		v := float64(k) / 4
+		fmt.Fprintf(bw, `<text x="%d" y="%.1f" text-anchor="end">%.2f</text>`+"\n", asfLeft-6, py(v)+4, v)
+		angle := -maxAngle + 2*maxAngle*float64(k)/4
+		fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" text-anchor="middle">%.3g</text>`+"\n", px(angle), py(0)+16, angle)
+	}
+	fmt.Fprintf(bw, `<text x="%.1f" y="%d" text-anchor="middle">Angle from optic axis (deg)</text>`+"\n",
+		asfLeft+plotW/2, asfHeight-10)
+	fmt.Fprintf(bw, `<text transform="translate(%d,%.1f) rotate(-90)" text-anchor="middle">Relative sensitivity</text>`+"\n",
+		16, asfTop+plotH/2)
+
+	for i, c := range curves {
+		peak := 0.0
+		for _, v := range c.PSF {
+			peak = math.Max(peak, v)
+		}
+		ly := float64(asfTop + 10 + 18*i)
+		fmt.Fprintf(bw, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="2"/>`+"\n",
+			asfLeft+plotW+12, ly, asfLeft+plotW+32, ly, c.Colour)
+		fmt.Fprintf(bw, `<text x="%.1f" y="%.1f">%s</text>`+"\n", asfLeft+plotW+38, ly+4, svgText(c.Label))
+		if peak <= 0 {
+			continue
+		}
+		var pts []string
+		for j := len(c.PSF) - 1; j > 0; j-- {
+			pts = append(pts, fmt.Sprintf("%.1f,%.1f", px(-float64(j)*ommatidialAngle), py(c.PSF[j]/peak)))
+		}
+		for j, v := range c.PSF {
+			pts = append(pts, fmt.Sprintf("%.1f,%.1f", px(float64(j)*ommatidialAngle), py(v/peak)))
+		}
+		fmt.Fprintf(bw, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`+"\n",
+			strings.Join(pts, " "), c.Colour)
+	}
+	fmt.Fprintln(bw, `</svg>`)
+	return bw.Flush()
+}
+
+// Case histogram layout, in SVG user units.
+const (
+	caseBar    = 6
+	caseLeft   = 60
+	caseRight  = 330
+	caseTop    = 20
+	casePlot   = 220
+	caseBottom = 50
+)
+
+// renderCaseHistogram draws, for every pigment state, a stacked bar of the rays ended
+// by each terminal case of the trace.
+func renderCaseHistogram(w io.Writer, summaries []blockSummary, rays int) error {
+	plotW := caseBar * len(summaries)
+	width := caseLeft + plotW + caseRight
+	height := caseTop + casePlot + caseBottom
+	scale := float64(casePlot) / math.Max(1, float64(rays))
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(bw, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+
+	for block, s := range summaries {
+		x := caseLeft + block*caseBar
+		y := float64(caseTop + casePlot)
+		for _, c := range caseColours {
+			n := s.Cases[c.Case]
+			if n == 0 {
+				continue
+			}
+			h := float64(n) * scale
+			y -= h
+			fmt.Fprintf(bw, `<rect x="%d" y="%.2f" width="%d" height="%.2f" fill="%s"><title>block %d: %d %s</title></rect>`+"\n",
+				x, y, caseBar, h, c.Colour, block, n, c.Case)
+		}
+	}
+	fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>`+"\n",
+		caseLeft, caseTop, plotW, casePlot)
+
+	for k := 0; k <= 4; k++ {
+		y := caseTop + casePlot - casePlot*k/4
+		fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="end">%.0f</text>`+"\n",
+			caseLeft-6, y+4, float64(rays)*float64(k)/4)
+	}
+	// Each group of pigmentSteps bars shares one shielding pigment position.
+	for k := 0; k < pigmentSteps; k++ {
+		fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="middle">%d</text>`+"\n",
+			caseLeft+(k*pigmentSteps*caseBar)+pigmentSteps*caseBar/2, caseTop+casePlot+16, k)
+	}
+	fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="middle">Pigment state (grouped by shielding step)</text>`+"\n",
+		caseLeft+plotW/2, height-10)
+	fmt.Fprintf(bw, `<text transform="translate(%d,%d) rotate(-90)" text-anchor="middle">Rays</text>`+"\n",
+		18, caseTop+casePlot/2)
+
+	for i, c := range caseColours {
+		y := caseTop + 10 + 18*i
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`+"\n", caseLeft+plotW+12, y-9, c.Colour)
+		fmt.Fprintf(bw, `<text x="%d" y="%d">%s</text>`+"\n", caseLeft+plotW+30, y+1, svgText(c.Description))
+	}
+	fmt.Fprintln(bw, `</svg>`)
+	return bw.Flush()
+}
+
+// newReportSpecies gathers the tables and figures the report shows for one species.
+func newReportSpecies(r speciesResult) (reportSpecies, error) {
+	m, summaries := r.Model, r.Summaries
+	p := m.Params
+	out := reportSpecies{Name: p.SpeciesName, Warnings: m.warnings(summaries)}
+
+	for _, f := range parameterFields {
+		label := f.Label
+		if f.Unit != "" {
+			label = fmt.Sprintf("%s (%s)", label, strings.Replace(f.Unit, "um", "µm", 1))
+		}
+		out.Parameters = append(out.Parameters, reportRow{label, fmt.Sprintf("%g", *f.Value(&p))})
+	}
+	out.Geometry = []reportRow{
+		{"facets across the eyeshine patch", fmt.Sprintf("%d", m.NumberOfFacets)},
+		{"ommatidial angle (deg)", fmt.Sprintf("%.4f", m.OmmatidialAngle)},
+		{"critical angle (deg)", fmt.Sprintf("%.4f", m.CriticalAngle)},
+		{"eye radius (µm)", fmt.Sprintf("%.2f", m.EyeRadius)},
+		{"eye circumference (µm)", fmt.Sprintf("%.2f", m.CircumferenceOfEye)},
+		{"aperture radius (µm)", fmt.Sprintf("%.2f", m.ApertureRadius)},
+		{"distance to aperture (µm)", fmt.Sprintf("%.2f", m.DistanceToAperture)},
+		{"angle at centre (deg)", fmt.Sprintf("%.4f", m.AngleAtCenter)},
+		{"aperture arc (µm)", fmt.Sprintf("%.2f", m.ApertureArc)},
+		{"rhabdom radius (µm)", fmt.Sprintf("%.2f", m.RhabdomRadius)},
+	}
+
+	var err error
+	for _, h := range []struct {
+		spec heatmapSpec
+		dst  *template.URL
+	}{
+		{resolutionHeatmap, &out.ResolutionHeatmap},
+		{sensitivityHeatmap, &out.SensitivityHeatmap},
+	} {
+		title := fmt.Sprintf("%s: %s", p.SpeciesName, h.spec.Title)
+		*h.dst, err = svgDataURI(func(w io.Writer) error {
+			return renderHeatmap(w, title, h.spec, summaries, p.RhabdomLength)
+		})
+		if err != nil {
+			return out, fmt.Errorf("drawing %s heatmap: %w", strings.ToLower(h.spec.Title), err)
+		}
+	}
+
+	dark, light := summaries[0], summaries[len(summaries)-1]
+	var buf bytes.Buffer
+	if err := renderAngularSensitivity(&buf, []angularCurve{
+		{fmt.Sprintf("dark-adapted (%s deg)", formatCell("%.2f", dark.FWHMDegrees)), "#1f3b73", dark.PSF},
+		{fmt.Sprintf("light-adapted (%s deg)", formatCell("%.2f", light.FWHMDegrees)), "#e08214", light.PSF},
+	}, m.OmmatidialAngle); err != nil {
+		return out, fmt.Errorf("drawing angular sensitivity: %w", err)
+	}
+	out.AngularSensitivity = template.HTML(buf.String())
+
+	buf.Reset()
+	if err := renderCaseHistogram(&buf, summaries, m.NumberOfFacets); err != nil {
+		return out, fmt.Errorf("drawing case histogram: %w", err)
+	}
+	out.CaseHistogram = template.HTML(buf.String())
+	return out, nil
+}
+
+// newReportComparison summarises one species for the cross-species table.
+func newReportComparison(r speciesResult) reportComparison {
+	summaries := r.Summaries
+	dark, light := summaries[0], summaries[len(summaries)-1]
+	minRes, maxSen := math.NaN(), math.Inf(-1)
+	for _, s := range summaries {
+		if !math.IsNaN(s.FWHMDegrees) && !(s.FWHMDegrees >= minRes) {
+			minRes = s.FWHMDegrees
+		}
+		maxSen = math.Max(maxSen, s.SensitivityPercent)
+	}
+	return reportComparison{
+		Name:            r.Model.Params.SpeciesName,
+		Facets:          r.Model.NumberOfFacets,
+		OmmatidialAngle: fmt.Sprintf("%.4f", r.Model.OmmatidialAngle),
+		DarkRes:         formatCell("%.2f", dark.FWHMDegrees),
+		DarkSen:         formatCell("%.2f", dark.SensitivityPercent),
+		LightRes:        formatCell("%.2f", light.FWHMDegrees),
+		LightSen:        formatCell("%.2f", light.SensitivityPercent),
+		MinRes:          formatCell("%.2f", minRes),
+		MaxSen:          formatCell("%.2f", maxSen),
+	}
+}
+
+// writeReport writes a single self-contained HTML page covering every species in a
+// run: its parameters, derived geometry, heatmaps, angular sensitivity, terminal
+// cases and warnings, with a table comparing the species. Everything is embedded, so
+// the file can be mailed or archived on its own.
+func writeReport(filename, parameterFile string, results []speciesResult, skipped []string) error {
+	data := reportData{
+		Version:       version,
+		Generated:     time.Now().Format(time.RFC3339),
+		ParameterFile: parameterFile,
+		Skipped:       skipped,
+	}
+	for _, r := range results {
+		if len(r.Summaries) != pigmentSteps*pigmentSteps {
+			return fmt.Errorf("expected %d pigment states for %s, got %d",
+				pigmentSteps*pigmentSteps, r.Model.Params.SpeciesName, len(r.Summaries))
+		}
+		species, err := newReportSpecies(r)
+		if err != nil {
+			return fmt.Errorf("reporting %s: %w", r.Model.Params.SpeciesName, err)
+		}
+		data.Species = append(data.Species, species)
+		data.Comparison = append(data.Comparison, newReportComparison(r))
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	if err := reportTemplate.Execute(file, data); err != nil {
+		return fmt.Errorf("writing %s: %w", filename, err)
+	}
+	return file.Close()
+}
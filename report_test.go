@@ -0,0 +1,75 @@
+// FILE: report_test.go
+// This file contains tests for the HTML report in report.go
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestWriteReport checks that the report embeds every figure, escapes the species
+// name, and carries the warnings and skipped parameter sets of the run.
+func TestWriteReport(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("nephrops <fl>"))
+	summaries := model.simulate(nil)
+	summaries[0].LostRays = 3
+
+	filename := filepath.Join(t.TempDir(), "report.html")
+	skipped := []string{"Skipping broken: facet width must be positive"}
+	if err := writeReport(filename, "params.txt", []speciesResult{{model, summaries}}, skipped); err != nil {
+		t.Fatalf("writeReport returned an unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read the report: %v", err)
+	}
+	report := string(data)
+
+	if strings.Contains(report, "nephrops <fl>") || !strings.Contains(report, "nephrops &lt;fl&gt;") {
+		t.Error("Expected the species name to be escaped")
+	}
+	if got := strings.Count(report, `<img src="data:image/svg`); got != 2 {
+		t.Errorf("Expected both heatmaps embedded as data URIs, got %d", got)
+	}
+	if got := strings.Count(report, "<svg"); got != 2 {
+		t.Errorf("Expected the angular sensitivity plot and case histogram inline, got %d SVGs", got)
+	}
+	if strings.Contains(report, `src="http`) || strings.Contains(report, `href="http`) {
+		t.Error("Expected the report to load no external assets")
+	}
+	if !strings.Contains(report, "3 of 3993 rays exceeded 90 degrees") {
+		t.Error("Expected the lost-ray warning in the report")
+	}
+	if !strings.Contains(report, skipped[0]) {
+		t.Error("Expected the skipped parameter set in the report")
+	}
+	if !strings.Contains(report, "<td>9.58</td><td>83.03</td>") {
+		t.Error("Expected the dark-adapted resolution and sensitivity in the comparison table")
+	}
+}
+
+// TestRenderAngularSensitivity checks that the plot mirrors the profile about the
+// optic axis, so a profile of n offsets is drawn through 2n-1 points.
+func TestRenderAngularSensitivity(t *testing.T) {
+	var b strings.Builder
+	if err := renderAngularSensitivity(&b, []angularCurve{
+		{"dark", "#000000", []float64{4, 3, 1, 0}},
+		{"empty", "#ffffff", nil},
+	}, 1.0); err != nil {
+		t.Fatalf("renderAngularSensitivity returned an unexpected error: %v", err)
+	}
+	svg := b.String()
+	wellFormedXML(t, svg)
+
+	if got := strings.Count(svg, "<polyline"); got != 1 {
+		t.Fatalf("Expected one curve, with none for the empty profile, got %d", got)
+	}
+	start := strings.Index(svg, `points="`) + len(`points="`)
+	points := strings.Fields(svg[start : start+strings.Index(svg[start:], `"`)])
+	if len(points) != 7 {
+		t.Errorf("Expected 7 points, got %d: %v", len(points), points)
+	}
+}
@@ -0,0 +1,178 @@
+// FILE: results.go
+// This file contains the machine-readable JSON results written for each run.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// resultsSchemaVersion identifies the layout of the JSON results file. It is bumped
+// whenever a field is renamed, removed or changes meaning, so that downstream code
+// can refuse a file it does not understand rather than misreading it.
+const resultsSchemaVersion = 1
+
+// resultsFile is the JSON document written to {species}_results.json.
+type resultsFile struct {
+	SchemaVersion  int            `json:"schema_version"`
+	ProgramVersion string         `json:"program_version"`
+	Parameters     parametersJSON `json:"parameters"`
+	Geometry       geometryJSON   `json:"geometry"`
+	Constants      constantsJSON  `json:"constants"`
+	Blocks         []blockJSON    `json:"blocks"`
+}
+
+// parametersJSON mirrors Parameters with explicit units in the key names.
+type parametersJSON struct {
+	SpeciesName              string  `json:"species_name"`
+	RhabdomLength            float64 `json:"rhabdom_length_um"`
+	RhabdomWidth             float64 `json:"rhabdom_width_um"`
+	EyeDiameter              float64 `json:"eye_diameter_um"`
+	FacetWidth               float64 `json:"facet_width_um"`
+	ApertureDiameter         float64 `json:"aperture_diameter_um"`
+	CytoplasmRefractiveIndex float64 `json:"cytoplasm_refractive_index"`
+	RhabdomRefractiveIndex   float64 `json:"rhabdom_refractive_index"`
+	BlurCircleExtent         float64 `json:"blur_circle_extent_rhabdoms"`
+	ProximalRhabdomAngle     float64 `json:"proximal_rhabdom_angle_deg"`
+}
+
+// geometryJSON holds the values Model derives from the parameters.
+type geometryJSON struct {
+	NumberOfFacets     int     `json:"number_of_facets"`
+	OmmatidialAngle    float64 `json:"ommatidial_angle_deg"`
+	CriticalAngle      float64 `json:"critical_angle_deg"`
+	CircumferenceOfEye float64 `json:"eye_circumference_um"`
+	EyeRadius          float64 `json:"eye_radius_um"`
+	ApertureRadius     float64 `json:"aperture_radius_um"`
+	DistanceToAperture float64 `json:"distance_to_aperture_um"`
+	AngleAtCenter      float64 `json:"angle_at_centre_deg"`
+	ApertureArc        float64 `json:"aperture_arc_um"`
+	RhabdomRadius      float64 `json:"rhabdom_radius_um"`
+}
+
+// blockJSON is the summary of one pigment state, with the pigment positions as their
+// extent in micrometres from the proximal end of the rhabdom. FWHMDegrees is null
+// wherever the resolution matrix reads NaN, since JSON has no representation of NaN.
+type blockJSON struct {
+	Block              int      `json:"block"`
+	ShieldingStep      int      `json:"shielding_step"`
+	TapetalStep        int      `json:"tapetal_step"`
+	Shielding          float64  `json:"shielding_um"`
+	Tapetal            float64  `json:"tapetal_um"`
+	FWHMDegrees        *float64 `json:"fwhm_deg"`
+	SensitivityPercent float64  `json:"sensitivity_pct"`
+	PeakOffset         int      `json:"peak_offset_rhabdoms"`
+	Annular            bool     `json:"annular"`
+	Rays               int      `json:"rays"`
+	LostRays           int      `json:"lost_rays"`
+}
+
+// constantsJSON records the constants built into the model that shape the results.
+type constantsJSON struct {
+	AbsorptionCoefficient float64 `json:"absorption_coefficient_per_um"`
+	PigmentSteps          int     `json:"pigment_steps"`
+	MaxPropagationAngle   float64 `json:"max_propagation_angle_deg"`
+}
+
+// optionalFloat returns nil for NaN, which JSON cannot represent, and v otherwise.
+func optionalFloat(v float64) *float64 {
+	if math.IsNaN(v) {
+		return nil
+	}
+	return &v
+}
+
+// newParametersJSON records a parameter set with the units in the key names.
+func newParametersJSON(p Parameters) parametersJSON {
+	return parametersJSON{
+		SpeciesName:              p.SpeciesName,
+		RhabdomLength:            p.RhabdomLength,
+		RhabdomWidth:             p.RhabdomWidth,
+		EyeDiameter:              p.EyeDiameter,
+		FacetWidth:               p.FacetWidth,
+		ApertureDiameter:         p.ApertureDiameter,
+		CytoplasmRefractiveIndex: p.CytoplasmRefractiveIndex,
+		RhabdomRefractiveIndex:   p.RhabdomRefractiveIndex,
+		BlurCircleExtent:         p.BlurCircleExtent,
+		ProximalRhabdomAngle:     p.ProximalRhabdomAngle,
+	}
+}
+
+// newGeometryJSON records the values the model derives from its parameters.
+func (m *Model) newGeometryJSON() geometryJSON {
+	return geometryJSON{
+		NumberOfFacets:     m.NumberOfFacets,
+		OmmatidialAngle:    m.OmmatidialAngle,
+		CriticalAngle:      m.CriticalAngle,
+		CircumferenceOfEye: m.CircumferenceOfEye,
+		EyeRadius:          m.EyeRadius,
+		ApertureRadius:     m.ApertureRadius,
+		DistanceToAperture: m.DistanceToAperture,
+		AngleAtCenter:      m.AngleAtCenter,
+		ApertureArc:        m.ApertureArc,
+		RhabdomRadius:      m.RhabdomRadius,
+	}
+}
+
+// newConstantsJSON records the constants built into the model.
+func newConstantsJSON() constantsJSON {
+	return constantsJSON{
+		AbsorptionCoefficient: absorptionCoefficient,
+		PigmentSteps:          pigmentSteps,
+		MaxPropagationAngle:   maxPropagationAngle,
+	}
+}
+
+// newResultsFile collects the parameters, derived geometry and per-block summaries of
+// a run into the JSON results document.
+func (m *Model) newResultsFile(summaries []blockSummary) resultsFile {
+	out := resultsFile{
+		SchemaVersion:  resultsSchemaVersion,
+		ProgramVersion: version,
+		Parameters:     newParametersJSON(m.Params),
+		Geometry:       m.newGeometryJSON(),
+		Constants:      newConstantsJSON(),
+		Blocks:         make([]blockJSON, len(summaries)),
+	}
+	for i, s := range summaries {
+		out.Blocks[i] = blockJSON{
+			Block:              i,
+			ShieldingStep:      i / pigmentSteps,
+			TapetalStep:        i % pigmentSteps,
+			Shielding:          s.Shielding,
+			Tapetal:            s.Tapetal,
+			FWHMDegrees:        optionalFloat(s.FWHMDegrees),
+			SensitivityPercent: s.SensitivityPercent,
+			PeakOffset:         s.PeakOffset,
+			Annular:            s.Annular,
+			Rays:               m.NumberOfFacets,
+			LostRays:           s.LostRays,
+		}
+	}
+	return out
+}
+
+// writeResultsJSON writes the parameters, derived geometry and every block summary of
+// a run to {species}_results.json.
+func (m *Model) writeResultsJSON(summaries []blockSummary) (string, error) {
+	filename := fmt.Sprintf("%s_results.json", m.Params.SpeciesName)
+	return filename, m.writeResultsJSONTo(filename, summaries)
+}
+
+// writeResultsJSONTo writes the results document to the named file.
+func (m *Model) writeResultsJSONTo(filename string, summaries []blockSummary) error {
+	if len(summaries) != pigmentSteps*pigmentSteps {
+		return fmt.Errorf("expected %d pigment states, got %d", pigmentSteps*pigmentSteps, len(summaries))
+	}
+	data, err := json.MarshalIndent(m.newResultsFile(summaries), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", filename, err)
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// FILE: results_test.go
+// This file contains tests for the JSON results in results.go
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"testing"
+)
+
+// TestWriteResultsJSON checks that the results file round-trips through a standard
+// JSON decoder and carries the block-to-pigment mapping explicitly, with the NaN
+// resolution of an annular state written as null.
+func TestWriteResultsJSON(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_results"))
+	summaries := model.simulate(nil)
+	summaries[5].FWHMDegrees = math.NaN()
+	summaries[5].Annular = true
+
+	if _, err := model.writeResultsJSON(summaries); err != nil {
+		t.Fatalf("writeResultsJSON returned an unexpected error: %v", err)
+	}
+	defer os.Remove("test_results_results.json")
+
+	data, err := os.ReadFile("test_results_results.json")
+	if err != nil {
+		t.Fatalf("Failed to read the results file: %v", err)
+	}
+	var got resultsFile
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("The results file is not valid JSON: %v", err)
+	}
+
+	if got.SchemaVersion != resultsSchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", resultsSchemaVersion, got.SchemaVersion)
+	}
+	if got.Parameters.SpeciesName != "test_results" || got.Parameters.BlurCircleExtent != 18 {
+		t.Errorf("Expected the input parameters to be recorded, got %+v", got.Parameters)
+	}
+	if got.Geometry.NumberOfFacets != model.NumberOfFacets || got.Geometry.CriticalAngle != model.CriticalAngle {
+		t.Errorf("Expected the derived geometry to be recorded, got %+v", got.Geometry)
+	}
+	if len(got.Blocks) != pigmentSteps*pigmentSteps {
+		t.Fatalf("Expected %d blocks, got %d", pigmentSteps*pigmentSteps, len(got.Blocks))
+	}
+
+	// Block 23 is shielding step 2, tapetal step 1.
+	b := got.Blocks[23]
+	if b.ShieldingStep != 2 || b.TapetalStep != 1 ||
+		math.Abs(b.Shielding-36) > 1e-9 || math.Abs(b.Tapetal-18) > 1e-9 {
+		t.Errorf("Expected block 23 at shielding 36 um, tapetal 18 um, got %+v", b)
+	}
+	if b.FWHMDegrees == nil || *b.FWHMDegrees != summaries[23].FWHMDegrees {
+		t.Errorf("Expected block 23 to carry its FWHM, got %v", b.FWHMDegrees)
+	}
+	if b.Rays != model.NumberOfFacets {
+		t.Errorf("Expected %d rays per block, got %d", model.NumberOfFacets, b.Rays)
+	}
+	if got.Blocks[5].FWHMDegrees != nil || !got.Blocks[5].Annular {
+		t.Errorf("Expected the annular block to have a null FWHM, got %+v", got.Blocks[5])
+	}
+}
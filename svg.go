@@ -0,0 +1,225 @@
+// FILE: svg.go
+// This file contains the SVG rendering of the summary matrices as heatmaps.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+)
+
+// viridisStops samples the viridis colour map at even intervals. It is perceptually
+// uniform and remains readable in greyscale and to colour-blind readers.
+var viridisStops = [][3]float64{
+	{68, 1, 84},
+	{72, 40, 120},
+	{62, 74, 137},
+	{49, 104, 142},
+	{38, 130, 142},
+	{31, 158, 137},
+	{53, 183, 121},
+	{109, 205, 89},
+	{180, 222, 44},
+	{253, 231, 37},
+}
+
+// colourFor maps t in [0, 1] onto the colour map, as an SVG colour.
+func colourFor(t float64) string {
+	t = math.Min(1, math.Max(0, t))
+	pos := t * float64(len(viridisStops)-1)
+	i := int(math.Floor(pos))
+	if i >= len(viridisStops)-1 {
+		i = len(viridisStops) - 2
+	}
+	frac := pos - float64(i)
+	var rgb [3]int
+	for c := range rgb {
+		rgb[c] = int(math.Round(viridisStops[i][c] + frac*(viridisStops[i+1][c]-viridisStops[i][c])))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+}
+
+// svgText escapes a string for use as SVG text or an attribute value.
+func svgText(s string) string {
+	return html.EscapeString(s)
+}
+
+// heatmapSpec describes one summary matrix to be drawn.
+type heatmapSpec struct {
+	Title string
+	// Label names the quantity and its unit, for the colour bar.
+	Label string
+	Value func(blockSummary) float64
+	// Format renders a cell value for the label drawn inside the cell.
+	Format string
+}
+
+var (
+	resolutionHeatmap = heatmapSpec{
+		Title:  "Resolution",
+		Label:  "Acceptance angle (deg)",
+		Value:  func(b blockSummary) float64 { return b.FWHMDegrees },
+		Format: "%.2f",
+	}
+	sensitivityHeatmap = heatmapSpec{
+		Title:  "Sensitivity",
+		Label:  "Light absorbed (%)",
+		Value:  func(b blockSummary) float64 { return b.SensitivityPercent },
+		Format: "%.1f",
+	}
+)
+
+// Heatmap layout, in SVG user units.
+const (
+	heatmapCell   = 44
+	heatmapLeft   = 90
+	heatmapTop    = 50
+	heatmapBarGap = 24
+	heatmapBar    = 18
+	heatmapRight  = 130
+	heatmapBottom = 70
+)
+
+// renderHeatmap draws an 11x11 summary matrix with the shielding pigment down the rows
+// and the tapetal pigment across the columns, matching the CSV matrices. Cells with
+// no defined value are drawn grey and hatched, and annular cells are hatched over
+// their colour, so neither can be mistaken for a measured value.
+func renderHeatmap(w io.Writer, title string, spec heatmapSpec, summaries []blockSummary, rhabdomLength float64) error {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range summaries {
+		if v := spec.Value(s); !math.IsNaN(v) && !math.IsInf(v, 0) {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+	}
+	if math.IsInf(lo, 1) {
+		lo, hi = 0, 1
+	}
+	if hi == lo {
+		hi = lo + 1
+	}
+
+	grid := heatmapCell * pigmentSteps
+	width := heatmapLeft + grid + heatmapRight
+	height := heatmapTop + grid + heatmapBottom
+	increment := rhabdomLength / float64(pigmentSteps-1)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		width, height, width, height)
+	fmt.Fprint(bw, `<defs><pattern id="hatch" width="6" height="6" patternUnits="userSpaceOnUse" patternTransform="rotate(45)">`+
+		`<line x1="0" y1="0" x2="0" y2="6" stroke="#333" stroke-width="1.5"/></pattern></defs>`+"\n")
+	fmt.Fprintf(bw, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+	fmt.Fprintf(bw, `<text x="%d" y="%d" font-size="15" text-anchor="middle">%s</text>`+"\n",
+		heatmapLeft+grid/2, heatmapTop-22, svgText(title))
+
+	for i, s := range summaries {
+		row, col := i/pigmentSteps, i%pigmentSteps
+		x, y := heatmapLeft+col*heatmapCell, heatmapTop+row*heatmapCell
+		v := spec.Value(s)
+		fill, textFill := "#bbbbbb", "black"
+		if !math.IsNaN(v) {
+			t := (v - lo) / (hi - lo)
+			fill = colourFor(t)
+			if t < 0.6 {
+				textFill = "white"
+			}
+		}
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"><title>shielding %.1f um, tapetal %.1f um: %s</title></rect>`+"\n",
+			x, y, heatmapCell, heatmapCell, fill, s.Shielding, s.Tapetal, formatCell(spec.Format, v))
+		if math.IsNaN(v) || s.Annular {
+			fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="url(#hatch)" pointer-events="none"/>`+"\n",
+				x, y, heatmapCell, heatmapCell)
+		}
+		if !math.IsNaN(v) {
+			fmt.Fprintf(bw, `<text x="%d" y="%d" font-size="9" text-anchor="middle" fill="%s" pointer-events="none">%s</text>`+"\n",
+				x+heatmapCell/2, y+heatmapCell/2+3, textFill, formatCell(spec.Format, v))
+		}
+	}
+	fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>`+"\n",
+		heatmapLeft, heatmapTop, grid, grid)
+
+	// Axes: tapetal pigment across the bottom, shielding pigment down the left.
+	for k := 0; k < pigmentSteps; k++ {
+		centre := k*heatmapCell + heatmapCell/2
+		fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="middle">%.4g</text>`+"\n",
+			heatmapLeft+centre, heatmapTop+grid+16, float64(k)*increment)
+		fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="end">%.4g</text>`+"\n",
+			heatmapLeft-6, heatmapTop+centre+4, float64(k)*increment)
+	}
+	fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="middle">Tapetal pigment (µm)</text>`+"\n",
+		heatmapLeft+grid/2, heatmapTop+grid+40)
+	fmt.Fprintf(bw, `<text transform="translate(%d,%d) rotate(-90)" text-anchor="middle">Shielding pigment (µm)</text>`+"\n",
+		heatmapLeft-52, heatmapTop+grid/2)
+
+	// Colour bar, with the highest value at the top.
+	barX := heatmapLeft + grid + heatmapBarGap
+	const barSteps = 50
+	step := float64(grid) / barSteps
+	for k := 0; k < barSteps; k++ {
+		fmt.Fprintf(bw, `<rect x="%d" y="%.2f" width="%d" height="%.2f" fill="%s"/>`+"\n",
+			barX, float64(heatmapTop)+float64(k)*step, heatmapBar, step+0.5, colourFor(1-(float64(k)+0.5)/barSteps))
+	}
+	fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>`+"\n",
+		barX, heatmapTop, heatmapBar, grid)
+	for k := 0; k <= 4; k++ {
+		y := heatmapTop + grid*k/4
+		fmt.Fprintf(bw, `<text x="%d" y="%d">%s</text>`+"\n",
+			barX+heatmapBar+4, y+4, formatCell(spec.Format, hi-(hi-lo)*float64(k)/4))
+	}
+	fmt.Fprintf(bw, `<text transform="translate(%d,%d) rotate(-90)" text-anchor="middle">%s</text>`+"\n",
+		barX+heatmapBar+64, heatmapTop+grid/2, svgText(spec.Label))
+
+	// Legend for the hatched cells.
+	fmt.Fprintf(bw, `<rect x="%d" y="%d" width="14" height="14" fill="#bbbbbb"/><rect x="%d" y="%d" width="14" height="14" fill="url(#hatch)"/>`+"\n",
+		heatmapLeft, heatmapTop+grid+50, heatmapLeft, heatmapTop+grid+50)
+	fmt.Fprintf(bw, `<text x="%d" y="%d">Hatched: no acceptance angle (annular or no light)</text>`+"\n",
+		heatmapLeft+20, heatmapTop+grid+61)
+
+	fmt.Fprintln(bw, `</svg>`)
+	return bw.Flush()
+}
+
+// formatCell renders a value with the given format, or "NaN" when it is undefined.
+func formatCell(format string, v float64) string {
+	if math.IsNaN(v) {
+		return "NaN"
+	}
+	return fmt.Sprintf(format, v)
+}
+
+// writeHeatmaps writes {species}_summary_res.svg and {species}_summary_sen.svg, drawn
+// from the same block summaries as the CSV matrices, and returns the names of the
+// files.
+func (m *Model) writeHeatmaps(summaries []blockSummary) ([]string, error) {
+	if len(summaries) != pigmentSteps*pigmentSteps {
+		return nil, fmt.Errorf("expected %d pigment states, got %d", pigmentSteps*pigmentSteps, len(summaries))
+	}
+	var written []string
+	for _, h := range []struct {
+		suffix string
+		spec   heatmapSpec
+	}{
+		{"res", resolutionHeatmap},
+		{"sen", sensitivityHeatmap},
+	} {
+		filename := fmt.Sprintf("%s_summary_%s.svg", m.Params.SpeciesName, h.suffix)
+		file, err := os.Create(filename)
+		if err != nil {
+			return written, fmt.Errorf("creating %s: %w", filename, err)
+		}
+		written = append(written, filename)
+		title := fmt.Sprintf("%s: %s", m.Params.SpeciesName, h.spec.Title)
+		if err := renderHeatmap(file, title, h.spec, summaries, m.Params.RhabdomLength); err != nil {
+			file.Close()
+			return written, fmt.Errorf("writing %s: %w", filename, err)
+		}
+		if err := file.Close(); err != nil {
+			return written, fmt.Errorf("writing %s: %w", filename, err)
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,75 @@
+// FILE: svg_test.go
+// This file contains tests for the SVG rendering in svg.go
+
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// wellFormedXML fails the test if the document is not well-formed XML.
+func wellFormedXML(t *testing.T, doc string) {
+	t.Helper()
+	decoder := xml.NewDecoder(strings.NewReader(doc))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("Expected well-formed SVG, got %v", err)
+		}
+	}
+}
+
+func TestColourFor(t *testing.T) {
+	if got := colourFor(0); got != "#440154" {
+		t.Errorf("Expected the bottom of the colour map to be #440154, got %s", got)
+	}
+	if got := colourFor(1); got != "#fde725" {
+		t.Errorf("Expected the top of the colour map to be #fde725, got %s", got)
+	}
+	if colourFor(-1) != colourFor(0) || colourFor(2) != colourFor(1) {
+		t.Error("Expected values outside [0, 1] to be clamped to the ends of the colour map")
+	}
+}
+
+// TestRenderHeatmapHatchesUndefinedCells checks that NaN and annular cells are drawn
+// hatched, so they cannot be read as measured values, and that the species name is
+// escaped.
+func TestRenderHeatmapHatchesUndefinedCells(t *testing.T) {
+	model := mustModel(t, nephropsFlatLateral("test_heatmap"))
+	summaries := model.simulate(nil)
+	summaries[7].FWHMDegrees = math.NaN()
+	summaries[7].Annular = true
+	summaries[8].FWHMDegrees = math.NaN()
+
+	var res strings.Builder
+	if err := renderHeatmap(&res, "a<b & c", resolutionHeatmap, summaries, 180); err != nil {
+		t.Fatalf("renderHeatmap returned an unexpected error: %v", err)
+	}
+	wellFormedXML(t, res.String())
+	if n := strings.Count(res.String(), `fill="url(#hatch)" pointer-events`); n != 2 {
+		t.Errorf("Expected 2 hatched cells in the resolution heatmap, got %d", n)
+	}
+	if !strings.Contains(res.String(), "a&lt;b &amp; c") {
+		t.Error("Expected the title to be escaped")
+	}
+	if !strings.Contains(res.String(), ">180</text>") {
+		t.Error("Expected the axes to be labelled in micrometres up to the rhabdom length")
+	}
+
+	// Sensitivity is defined for the annular state, so it keeps its colour but is
+	// still hatched to flag the ring-shaped profile.
+	var sen strings.Builder
+	if err := renderHeatmap(&sen, "sen", sensitivityHeatmap, summaries, 180); err != nil {
+		t.Fatalf("renderHeatmap returned an unexpected error: %v", err)
+	}
+	if n := strings.Count(sen.String(), `fill="url(#hatch)" pointer-events`); n != 1 {
+		t.Errorf("Expected 1 hatched cell in the sensitivity heatmap, got %d", n)
+	}
+}
@@ -0,0 +1,72 @@
+// FILE: sweep.go
+// This file contains the parameter sweep, which reruns the model while stepping one
+// parameter across a range of values.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// sweepHeader labels the columns of the sweep output. Like the pathlengths file, each
+// row carries its own keys, so the file can be filtered or pivoted directly.
+const sweepHeader = "value,block,shielding_um,tapetal_um,fwhm_deg,sensitivity_pct,annular"
+
+// sweepValues returns steps evenly spaced values from from to to inclusive.
+func sweepValues(from, to float64, steps int) []float64 {
+	if steps <= 1 {
+		return []float64{from}
+	}
+	values := make([]float64, steps)
+	for i := range values {
+		values[i] = from + (to-from)*float64(i)/float64(steps-1)
+	}
+	return values
+}
+
+// runSweep simulates the base parameter set once for each value of the named field
+// and writes every pigment state of every run to {species}_sweep_{field}.csv. Values
+// that do not describe a realisable eye are reported and skipped, so a sweep can run
+// up to the edge of the valid range without being abandoned there. It returns the
+// number of values that were simulated.
+func runSweep(base Parameters, field parameterField, values []float64) (int, error) {
+	filename := fmt.Sprintf("%s_sweep_%s.csv", base.SpeciesName, field.Name)
+	file, err := os.Create(filename)
+	if err != nil {
+		return 0, fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, sweepHeader)
+
+	simulated := 0
+	for _, v := range values {
+		params := base
+		*field.Value(&params) = v
+		model, err := NewModel(params)
+		if err != nil {
+			log.Printf("Skipping %s = %g for %s: %v", field.Name, v, base.SpeciesName, err)
+			continue
+		}
+
+		for block, s := range model.simulate(nil) {
+			if _, err := fmt.Fprintf(writer, "%s,%d,%.6f,%.6f,%s,%s,%t\n",
+				strconv.FormatFloat(v, 'g', -1, 64), block, s.Shielding, s.Tapetal,
+				strconv.FormatFloat(s.FWHMDegrees, 'f', 4, 64),
+				strconv.FormatFloat(s.SensitivityPercent, 'f', 4, 64), s.Annular); err != nil {
+				return simulated, fmt.Errorf("writing %s: %w", filename, err)
+			}
+		}
+		simulated++
+	}
+	if err := writer.Flush(); err != nil {
+		return simulated, fmt.Errorf("writing %s: %w", filename, err)
+	}
+	return simulated, nil
+}
@@ -0,0 +1,81 @@
+// FILE: sweep_test.go
+// This file contains tests for the parameter sweep in sweep.go
+
+package main
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSweepValues(t *testing.T) {
+	got := sweepValues(1, 3, 5)
+	want := []float64{1, 1.5, 2, 2.5, 3}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d values, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-12 {
+			t.Errorf("Value %d: expected %f, got %f", i, want[i], got[i])
+		}
+	}
+	if got := sweepValues(7, 9, 1); len(got) != 1 || got[0] != 7 {
+		t.Errorf("Expected a single step to give only the first value, got %v", got)
+	}
+}
+
+// TestRunSweepSkipsInvalidValues checks that a sweep reaching past the valid range
+// keeps the values it could simulate rather than abandoning the whole sweep.
+func TestRunSweepSkipsInvalidValues(t *testing.T) {
+	params := nephropsFlatLateral("test_sweep")
+	field, ok := lookupParameterField("blurcircleextent")
+	if !ok {
+		t.Fatal("Expected BlurCircleExtent to be found regardless of case")
+	}
+
+	// Zero is below the minimum blur circle of one rhabdom.
+	n, err := runSweep(params, field, []float64{0, 1, 18})
+	if err != nil {
+		t.Fatalf("runSweep returned an unexpected error: %v", err)
+	}
+	defer os.Remove("test_sweep_sweep_BlurCircleExtent.csv")
+	if n != 2 {
+		t.Errorf("Expected 2 values to be simulated, got %d", n)
+	}
+
+	lines := readLines(t, "test_sweep_sweep_BlurCircleExtent.csv")
+	if lines[0] != sweepHeader {
+		t.Fatalf("Expected the header %q, got %q", sweepHeader, lines[0])
+	}
+	if want := 1 + 2*pigmentSteps*pigmentSteps; len(lines) != want {
+		t.Errorf("Expected %d rows, got %d", want, len(lines))
+	}
+	if !strings.HasPrefix(lines[1], "1,0,") || !strings.HasPrefix(lines[len(lines)-1], "18,120,") {
+		t.Errorf("Expected rows keyed by value and block, got %q ... %q", lines[1], lines[len(lines)-1])
+	}
+}
+
+// TestRunSweepPigmentPositions checks that a sweep of the rhabdom length places the
+// pigments of each value on that value's own grid.
+func TestRunSweepPigmentPositions(t *testing.T) {
+	t.Chdir(t.TempDir())
+	params := nephropsFlatLateral("test_sweep")
+	field, _ := lookupParameterField("RhabdomLength")
+	if _, err := runSweep(params, field, []float64{100, 250}); err != nil {
+		t.Fatalf("runSweep returned an unexpected error: %v", err)
+	}
+
+	for _, line := range readLines(t, "test_sweep_sweep_RhabdomLength.csv")[1:] {
+		fields := strings.Split(line, ",")
+		value, _ := strconv.ParseFloat(fields[0], 64)
+		block, _ := strconv.Atoi(fields[1])
+		params.RhabdomLength = value
+		shielding, tapetal := mustModel(t, params).pigmentPositions(block)
+		if fields[2] != strconv.FormatFloat(shielding, 'f', 6, 64) || fields[3] != strconv.FormatFloat(tapetal, 'f', 6, 64) {
+			t.Fatalf("Length %g, block %d: expected pigments at %f and %f, got %q", value, block, shielding, tapetal, line)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// FILE: validate.go
+// This file contains the parameter file validation used by the validate command.
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// parameterCheck is the outcome of validating one parsed row of a parameter file.
+type parameterCheck struct {
+	Line    int
+	Species string
+	// Model carries the derived geometry, or nil when the parameters themselves are
+	// too broken to derive it from.
+	Model    *Model
+	Problems []parameterProblem
+}
+
+// checkParameterRecords runs every parameter and geometry check on each record,
+// without running any simulation.
+func checkParameterRecords(records []parameterRecord) []parameterCheck {
+	checks := make([]parameterCheck, 0, len(records))
+	firstLine := map[string]int{}
+	for _, r := range records {
+		check := parameterCheck{Line: r.Line, Species: r.Params.SpeciesName}
+		check.Problems = checkParameters(r.Params)
+		usable := len(check.Problems) == 0
+
+		// Every output file is named after the species, so a repeated name would
+		// silently overwrite the results of the earlier row.
+		if line, seen := firstLine[r.Params.SpeciesName]; seen && r.Params.SpeciesName != "" {
+			check.Problems = append(check.Problems, parameterProblem{
+				Field: "SpeciesName",
+				Err:   fmt.Errorf("species name %q is already used on line %d", r.Params.SpeciesName, line),
+				Fix:   "give each parameter set a unique name, since output files are named after it",
+			})
+		} else {
+			firstLine[r.Params.SpeciesName] = r.Line
+		}
+
+		// The derived geometry is only meaningful once the inputs are finite and in
+		// range; before that it would report NaNs rather than anything useful.
+		if usable {
+			m := &Model{Params: r.Params}
+			m.initialCalculations()
+			check.Model = m
+			check.Problems = append(check.Problems, m.checkGeometry()...)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// writeValidationReport writes one entry per row of the parameter file, in file
+// order, listing every problem found with a suggested fix and the derived geometry of
+// each row it could be calculated for. It returns the number of problems reported.
+func writeValidationReport(w io.Writer, filename string, checks []parameterCheck, recordErrors []*recordError) int {
+	type entry struct {
+		line  int
+		write func()
+	}
+	var entries []entry
+	problems := 0
+
+	for _, e := range recordErrors {
+		entries = append(entries, entry{e.Line, func() {
+			fmt.Fprintf(w, "%s: %v\n", filename, e)
+			if e.Field != "" {
+				fmt.Fprintf(w, "    fix: replace it with a number\n")
+			} else {
+				fmt.Fprintf(w, "    fix: give the species name followed by the %d numeric parameters\n",
+					len(parameterFields))
+			}
+		}})
+		problems++
+	}
+	for _, c := range checks {
+		entries = append(entries, entry{c.Line, func() {
+			if len(c.Problems) == 0 {
+				fmt.Fprintf(w, "%s: line %d (%s): ok\n", filename, c.Line, c.Species)
+			}
+			for _, p := range c.Problems {
+				where := ""
+				if p.Field != "" {
+					where = ", " + p.Field
+				}
+				fmt.Fprintf(w, "%s: line %d (%s)%s: %v\n", filename, c.Line, c.Species, where, p.Err)
+				if p.Fix != "" {
+					fmt.Fprintf(w, "    fix: %s\n", p.Fix)
+				}
+			}
+			if m := c.Model; m != nil {
+				fmt.Fprintf(w, "    %d facets across the eyeshine patch, ommatidial angle %.4f deg, critical angle %.4f deg\n",
+					m.NumberOfFacets, m.OmmatidialAngle, m.CriticalAngle)
+				fmt.Fprintf(w, "    aperture arc %.2f um, angle at centre %.4f deg, maximum blur circle extent %d\n",
+					m.ApertureArc, m.AngleAtCenter, m.NumberOfFacets)
+			}
+		}})
+		problems += len(c.Problems)
+	}
+
+	// A row can only produce a record error or a check, never both, so a stable
+	// sort by line restores file order.
+	slices.SortStableFunc(entries, func(a, b entry) int { return cmp.Compare(a.line, b.line) })
+	for _, e := range entries {
+		e.write()
+	}
+	return problems
+}
@@ -0,0 +1,80 @@
+// FILE: validate_test.go
+// This file contains tests for the parameter file validation in validate.go
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestValidateReportsEveryProblem checks that a file is reported in one pass: every
+// malformed row, every bad field of a row, and the geometry of the rows that parse,
+// rather than stopping at the first rejection as a run does.
+func TestValidateReportsEveryProblem(t *testing.T) {
+	content := `nephropsfl,180,25,7800,50,3200,1.34,1.37,18,0
+nephropsfl,180,25,7800,50,3200,1.34,1.37,40,0
+short,1,1
+typos,abc,25,7800,50,3200,1.34,x,18,0
+broken,180,-25,7800,50,9000,1.40,1.37,0,NaN`
+	filename := writeTempFile(t, content)
+	records, recordErrors, err := readParameterFile(filename)
+	if err != nil {
+		t.Fatalf("readParameterFile returned an unexpected error: %v", err)
+	}
+	if len(records) != 3 || len(recordErrors) != 3 {
+		t.Fatalf("Expected 3 parsed rows and 3 record errors, got %d and %d", len(records), len(recordErrors))
+	}
+	for i, want := range []struct {
+		line  int
+		field string
+	}{{3, ""}, {4, "RhabdomLength"}, {4, "RhabdomRefractiveIndex"}} {
+		if got := recordErrors[i]; got.Line != want.line || got.Field != want.field {
+			t.Errorf("Record error %d: expected line %d field %q, got line %d field %q",
+				i, want.line, want.field, got.Line, got.Field)
+		}
+	}
+
+	checks := checkParameterRecords(records)
+	fields := func(c parameterCheck) []string {
+		var out []string
+		for _, p := range c.Problems {
+			out = append(out, p.Field)
+		}
+		return out
+	}
+	if len(checks[0].Problems) != 0 || checks[0].Model == nil {
+		t.Errorf("Expected the first row to be valid with derived geometry, got %v", fields(checks[0]))
+	}
+	if got := strings.Join(fields(checks[1]), ","); got != "SpeciesName,BlurCircleExtent" {
+		t.Errorf("Expected a duplicate name and an oversized blur circle on line 2, got %s", got)
+	}
+	var blurFix string
+	for _, p := range checks[1].Problems {
+		if p.Field == "BlurCircleExtent" {
+			blurFix = p.Fix
+		}
+	}
+	if !strings.Contains(blurFix, "at most 33") {
+		t.Errorf("Expected the fix to give the largest legal blur circle extent, got %q", blurFix)
+	}
+	want := "ProximalRhabdomAngle,RhabdomWidth,ApertureDiameter,RhabdomRefractiveIndex,BlurCircleExtent"
+	if got := strings.Join(fields(checks[2]), ","); got != want {
+		t.Errorf("Expected every problem on line 5:\n  %s\ngot\n  %s", want, got)
+	}
+	if checks[2].Model != nil {
+		t.Error("Expected no derived geometry for parameters that are out of range")
+	}
+
+	var out strings.Builder
+	if n := writeValidationReport(&out, "params.csv", checks, recordErrors); n != 10 {
+		t.Errorf("Expected 10 problems to be reported, got %d", n)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if !strings.HasPrefix(lines[0], "params.csv: line 1 (nephropsfl): ok") {
+		t.Errorf("Expected the report to start with line 1, got %q", lines[0])
+	}
+	if !strings.Contains(out.String(), "params.csv: line 3 (short): expected 10 fields, got 3") {
+		t.Errorf("Expected the short row to be reported in place, got:\n%s", out.String())
+	}
+}